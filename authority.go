@@ -0,0 +1,133 @@
+package tukpdq
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/ipthomas/tukcnst"
+)
+
+const (
+	NHS_NUMBER_FHIR_SYSTEM = "https://fhir.nhs.uk/Id/nhs-number"
+	NHS_NUMBER_NAMESPACE   = "NHS"
+	HL7V2_UNIVERSAL_ID_ISO = "ISO"
+	HL7V2_UNIVERSAL_ID_URI = "URI"
+	PIXM_SYSTEM_OID        = "oid"
+	PIXM_SYSTEM_URN_OID    = "urn:oid"
+	PIXM_SYSTEM_FHIR       = "fhir"
+)
+
+// AssigningAuthority describes an identifier domain by its OID, FHIR system URI, HL7 v2 namespace id and name
+type AssigningAuthority struct {
+	Name            string `json:",omitempty"`
+	OID             string `json:",omitempty"`
+	FHIR_System     string `json:",omitempty"`
+	HL7V2_Namespace string `json:",omitempty"`
+}
+
+var authorities = struct {
+	sync.RWMutex
+	byOID map[string]AssigningAuthority
+}{byOID: map[string]AssigningAuthority{
+	tukcnst.NHS_OID_DEFAULT: {Name: "NHS Number", OID: tukcnst.NHS_OID_DEFAULT, FHIR_System: NHS_NUMBER_FHIR_SYSTEM, HL7V2_Namespace: NHS_NUMBER_NAMESPACE},
+}}
+
+// Register_Authority adds or replaces the assigning authority for an identifier domain OID
+func Register_Authority(aa AssigningAuthority) error {
+	if !isOID(aa.OID) {
+		return errors.New("invalid assigning authority - " + aa.OID + " is not a valid oid")
+	}
+	authorities.Lock()
+	defer authorities.Unlock()
+	authorities.byOID[aa.OID] = aa
+	return nil
+}
+
+// Authority_From_OID returns the registered assigning authority for the OID, or an authority with just the OID
+func Authority_From_OID(oid string) AssigningAuthority {
+	authorities.RLock()
+	defer authorities.RUnlock()
+	if aa, ok := authorities.byOID[oid]; ok {
+		return aa
+	}
+	return AssigningAuthority{OID: oid}
+}
+
+// Authority_From_System returns the assigning authority for a FHIR identifier system URI, urn:oid: URI or OID
+func Authority_From_System(system string) (AssigningAuthority, bool) {
+	if strings.HasPrefix(system, tukcnst.URN_OID_PREFIX) {
+		return Authority_From_OID(strings.TrimPrefix(system, tukcnst.URN_OID_PREFIX)), true
+	}
+	authorities.RLock()
+	for _, aa := range authorities.byOID {
+		if aa.FHIR_System != "" && aa.FHIR_System == system {
+			authorities.RUnlock()
+			return aa, true
+		}
+	}
+	authorities.RUnlock()
+	if isOID(system) {
+		return Authority_From_OID(system), true
+	}
+	return AssigningAuthority{FHIR_System: system}, false
+}
+
+// System returns the FHIR identifier system URI of the authority, or the urn:oid: form of its OID
+func (aa AssigningAuthority) System() string {
+	if aa.FHIR_System != "" {
+		return aa.FHIR_System
+	}
+	if !isOID(aa.OID) {
+		return ""
+	}
+	return tukcnst.URN_OID_PREFIX + aa.OID
+}
+
+// Display_Name returns the friendly name of the authority, falling back to the HL7 v2 namespace and then the OID
+func (aa AssigningAuthority) Display_Name() string {
+	switch {
+	case aa.Name != "":
+		return aa.Name
+	case aa.HL7V2_Namespace != "":
+		return aa.HL7V2_Namespace
+	}
+	return aa.OID
+}
+
+// PIXm_System returns the identifier system sent in a PIXm query for the style, oid (default), urn:oid or fhir
+func (aa AssigningAuthority) PIXm_System(style string) string {
+	switch style {
+	case PIXM_SYSTEM_URN_OID:
+		if isOID(aa.OID) {
+			return tukcnst.URN_OID_PREFIX + aa.OID
+		}
+	case PIXM_SYSTEM_FHIR:
+		return aa.System()
+	}
+	return aa.OID
+}
+
+// OID_From_System returns the OID for a FHIR identifier system, or the system unchanged if it cannot be resolved to an OID
+func OID_From_System(system string) string {
+	if aa, ok := Authority_From_System(system); ok {
+		return aa.OID
+	}
+	return system
+}
+func isOID(oid string) bool {
+	if oid == "" || strings.HasPrefix(oid, ".") || strings.HasSuffix(oid, ".") {
+		return false
+	}
+	for _, arc := range strings.Split(oid, ".") {
+		if arc == "" || (len(arc) > 1 && arc[0] == '0') {
+			return false
+		}
+		for _, c := range arc {
+			if c < '0' || c > '9' {
+				return false
+			}
+		}
+	}
+	return strings.Contains(oid, ".") && oid[0] >= '0' && oid[0] <= '2'
+}
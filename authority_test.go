@@ -0,0 +1,46 @@
+package tukpdq
+
+import (
+	"testing"
+
+	"github.com/ipthomas/tukcnst"
+)
+
+func TestPIXmSystem(t *testing.T) {
+	nhs := Authority_From_OID(tukcnst.NHS_OID_DEFAULT)
+	local := Authority_From_OID("2.16.840.1.113883.2.1.3.31.2.1.1")
+	tests := []struct {
+		aa    AssigningAuthority
+		style string
+		want  string
+	}{
+		{nhs, "", tukcnst.NHS_OID_DEFAULT},
+		{nhs, PIXM_SYSTEM_OID, tukcnst.NHS_OID_DEFAULT},
+		{nhs, PIXM_SYSTEM_URN_OID, "urn:oid:" + tukcnst.NHS_OID_DEFAULT},
+		{nhs, PIXM_SYSTEM_FHIR, NHS_NUMBER_FHIR_SYSTEM},
+		{local, PIXM_SYSTEM_FHIR, "urn:oid:2.16.840.1.113883.2.1.3.31.2.1.1"},
+	}
+	for _, tt := range tests {
+		if got := tt.aa.PIXm_System(tt.style); got != tt.want {
+			t.Errorf("%s PIXm_System(%q) = %q, want %q", tt.aa.OID, tt.style, got, tt.want)
+		}
+	}
+}
+
+func TestAuthorityFromSystem(t *testing.T) {
+	tests := []struct {
+		system string
+		oid    string
+		ok     bool
+	}{
+		{NHS_NUMBER_FHIR_SYSTEM, tukcnst.NHS_OID_DEFAULT, true},
+		{"urn:oid:" + tukcnst.NHS_OID_DEFAULT, tukcnst.NHS_OID_DEFAULT, true},
+		{"1.2.3", "1.2.3", true},
+		{"https://fhir.trust.nhs.uk/Id/unregistered", "", false},
+	}
+	for _, tt := range tests {
+		if aa, ok := Authority_From_System(tt.system); aa.OID != tt.oid || ok != tt.ok {
+			t.Errorf("Authority_From_System(%q) = %q, %v, want %q, %v", tt.system, aa.OID, ok, tt.oid, tt.ok)
+		}
+	}
+}
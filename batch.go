@@ -0,0 +1,160 @@
+package tukpdq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const BATCH_DEFAULT_WORKERS = 4
+
+// Batch_Config sets the batch worker count (default 4), per server rate limit and progress callback
+type Batch_Config struct {
+	Workers    int                 `json:",omitempty"`
+	Rate_Limit float64             `json:",omitempty"`
+	Progress   func(BatchProgress) `json:"-"`
+}
+
+// BatchProgress is the progress of a batch. Total is 0 for a batch read from a channel
+type BatchProgress struct {
+	Total     int
+	Completed int
+	Failed    int
+}
+
+// BatchResult is the result of a batch query. Index is the position of the query in the batch and Err the error returned by the query
+type BatchResult struct {
+	Index int
+	Query *PDQQuery
+	Err   error
+}
+
+// New_Batch runs the queries and returns their results in completion order. Cancelling does not interrupt queries already sent
+func New_Batch(ctx context.Context, queries []*PDQQuery, cfg Batch_Config) <-chan BatchResult {
+	in := make(chan *PDQQuery, len(queries))
+	for _, q := range queries {
+		in <- q
+	}
+	close(in)
+	return runBatch(ctx, in, len(queries), cfg)
+}
+
+// New_Batch_Stream runs the queries read from the channel and returns their results in completion order
+func New_Batch_Stream(ctx context.Context, queries <-chan *PDQQuery, cfg Batch_Config) <-chan BatchResult {
+	return runBatch(ctx, queries, 0, cfg)
+}
+func runBatch(ctx context.Context, queries <-chan *PDQQuery, total int, cfg Batch_Config) <-chan BatchResult {
+	workers := cfg.Workers
+	if workers < 1 {
+		workers = BATCH_DEFAULT_WORKERS
+	}
+	jobs := make(chan BatchResult)
+	done := make(chan BatchResult)
+	results := make(chan BatchResult)
+	limiters := rateLimiters{limit: cfg.Rate_Limit, byURL: make(map[string]*rateLimiter)}
+	go func() {
+		defer close(jobs)
+		for n := 0; ; n++ {
+			var q *PDQQuery
+			ok := true
+			if total > 0 {
+				q, ok = <-queries
+			} else {
+				select {
+				case <-ctx.Done():
+					return
+				case q, ok = <-queries:
+				}
+			}
+			if !ok {
+				return
+			}
+			jobs <- BatchResult{Index: n, Query: q}
+		}
+	}()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				switch {
+				case job.Query == nil:
+					job.Err = errors.New("invalid request - batch query is nil")
+				case ctx.Err() != nil:
+					job.Err = ctx.Err()
+				default:
+					if job.Err = limiters.wait(ctx, job.Query.Server_URL); job.Err == nil {
+						job.Err = New_Transaction(job.Query)
+					}
+				}
+				done <- job
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	go func() {
+		defer close(results)
+		progress := BatchProgress{Total: total}
+		for result := range done {
+			progress.Completed++
+			if result.Err != nil {
+				progress.Failed++
+			}
+			if cfg.Progress != nil {
+				cfg.Progress(progress)
+			}
+			results <- result
+		}
+	}()
+	return results
+}
+
+// rateLimiters holds a rate limiter for each server url in a batch
+type rateLimiters struct {
+	sync.Mutex
+	limit float64
+	byURL map[string]*rateLimiter
+}
+type rateLimiter struct {
+	sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// wait blocks until the next query can be sent to the url or the context is cancelled
+func (l *rateLimiters) wait(ctx context.Context, url string) error {
+	if l.limit <= 0 {
+		return nil
+	}
+	l.Lock()
+	rl, ok := l.byURL[url]
+	if !ok {
+		rl = &rateLimiter{interval: time.Duration(float64(time.Second) / l.limit)}
+		l.byURL[url] = rl
+	}
+	l.Unlock()
+	rl.Lock()
+	now := time.Now()
+	if rl.next.Before(now) {
+		rl.next = now
+	}
+	delay := rl.next.Sub(now)
+	rl.next = rl.next.Add(rl.interval)
+	rl.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
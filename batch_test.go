@@ -0,0 +1,196 @@
+package tukpdq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchTestServer is a PIXm server that records the time of each request and the highest number of requests in flight at once
+type batchTestServer struct {
+	*httptest.Server
+	sync.Mutex
+	delay    time.Duration
+	inFlight int
+	maxIn    int
+	times    []time.Time
+	started  chan struct{}
+	release  chan struct{}
+}
+
+func newBatchTestServer(delay time.Duration) *batchTestServer {
+	s := &batchTestServer{delay: delay}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Lock()
+		s.inFlight++
+		if s.inFlight > s.maxIn {
+			s.maxIn = s.inFlight
+		}
+		s.times = append(s.times, time.Now())
+		started, release := s.started, s.release
+		s.Unlock()
+		if started != nil {
+			started <- struct{}{}
+			<-release
+		}
+		time.Sleep(s.delay)
+		s.Lock()
+		s.inFlight--
+		s.Unlock()
+		fmt.Fprint(w, `{"resourceType":"Bundle","total":1,"entry":[{"resource":{"resourceType":"Patient","id":"1","identifier":[{"system":"urn:oid:2.16.840.1.113883.2.1.4.1","value":"9999999468"}]}}]}`)
+	}))
+	return s
+}
+func (s *batchTestServer) newQueries(n int) []*PDQQuery {
+	queries := make([]*PDQQuery, n)
+	for q := range queries {
+		queries[q] = &PDQQuery{Server_Mode: "pixm", Server_URL: s.URL, REG_OID: "2.16.840.1.113883.2.1.3.31.2.1.1", NHS_ID: "9999999468", HTTPClient: http.DefaultClient}
+	}
+	return queries
+}
+func collectBatch(results <-chan BatchResult) []BatchResult {
+	var got []BatchResult
+	for r := range results {
+		got = append(got, r)
+	}
+	sort.Slice(got, func(x, y int) bool { return got[x].Index < got[y].Index })
+	return got
+}
+
+func TestBatchWorkersAndProgress(t *testing.T) {
+	srv := newBatchTestServer(20 * time.Millisecond)
+	defer srv.Close()
+	queries := srv.newQueries(12)
+	queries[4] = nil
+	queries[7].NHS_ID = "9434765918"
+	var progress []BatchProgress
+	cfg := Batch_Config{Workers: 3, Progress: func(p BatchProgress) { progress = append(progress, p) }}
+	got := collectBatch(New_Batch(context.Background(), queries, cfg))
+	if len(got) != 12 {
+		t.Fatalf("New_Batch() returned %v results, want 12", len(got))
+	}
+	for n, r := range got {
+		switch n {
+		case 4:
+			if r.Err == nil || r.Query != nil {
+				t.Errorf("result %v = %+v, want a nil query error", n, r)
+			}
+		case 7:
+			var verr *ValidationError
+			if !errors.As(r.Err, &verr) || r.Query != queries[7] {
+				t.Errorf("result %v error = %v, want a validation error", n, r.Err)
+			}
+		default:
+			if r.Index != n || r.Err != nil || r.Query != queries[n] || r.Query.Count != 1 {
+				t.Errorf("result %v = index %v, error %v, want the query with 1 patient", n, r.Index, r.Err)
+			}
+		}
+	}
+	srv.Lock()
+	maxIn, requests := srv.maxIn, len(srv.times)
+	srv.Unlock()
+	if maxIn > 3 || maxIn < 2 || requests != 10 {
+		t.Errorf("server requests = %v, max in flight = %v, want 10 requests with at most 3 in flight", requests, maxIn)
+	}
+	if len(progress) != 12 {
+		t.Fatalf("progress called %v times, want 12", len(progress))
+	}
+	for n, p := range progress {
+		if p.Total != 12 || p.Completed != n+1 {
+			t.Errorf("progress %v = %+v, want total 12 and %v completed", n, p, n+1)
+		}
+	}
+	if last := progress[len(progress)-1]; last.Failed != 2 {
+		t.Errorf("final progress = %+v, want 2 failed", last)
+	}
+}
+
+func TestBatchRateLimit(t *testing.T) {
+	srv := newBatchTestServer(0)
+	defer srv.Close()
+	start := time.Now()
+	got := collectBatch(New_Batch(context.Background(), srv.newQueries(5), Batch_Config{Workers: 5, Rate_Limit: 20}))
+	elapsed := time.Since(start)
+	for _, r := range got {
+		if r.Err != nil {
+			t.Errorf("result %v error = %v", r.Index, r.Err)
+		}
+	}
+	srv.Lock()
+	times := append([]time.Time{}, srv.times...)
+	srv.Unlock()
+	if len(times) != 5 {
+		t.Fatalf("server requests = %v, want 5", len(times))
+	}
+	sort.Slice(times, func(x, y int) bool { return times[x].Before(times[y]) })
+	if span := times[4].Sub(times[0]); span < 190*time.Millisecond || elapsed < 190*time.Millisecond {
+		t.Errorf("5 requests at 20 per second took %v, first to last request %v, want at least 200ms", elapsed, span)
+	}
+	for n := 1; n < len(times); n++ {
+		if gap := times[n].Sub(times[n-1]); gap < 30*time.Millisecond {
+			t.Errorf("gap between requests %v and %v = %v, want about 50ms", n-1, n, gap)
+		}
+	}
+}
+
+func TestBatchCancel(t *testing.T) {
+	srv := newBatchTestServer(0)
+	defer srv.Close()
+	srv.started, srv.release = make(chan struct{}), make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queries := srv.newQueries(5)
+	var progress BatchProgress
+	results := New_Batch(ctx, queries, Batch_Config{Workers: 1, Progress: func(p BatchProgress) { progress = p }})
+	<-srv.started
+	cancel()
+	close(srv.release)
+	got := collectBatch(results)
+	if len(got) != 5 {
+		t.Fatalf("New_Batch() returned %v results, want 5", len(got))
+	}
+	if got[0].Err != nil || got[0].Query.Count != 1 {
+		t.Errorf("in flight result = %+v, error %v, want the completed query", got[0].Query, got[0].Err)
+	}
+	for _, r := range got[1:] {
+		if !errors.Is(r.Err, context.Canceled) || r.Query.Count != 0 {
+			t.Errorf("result %v error = %v, want context.Canceled", r.Index, r.Err)
+		}
+	}
+	srv.Lock()
+	requests := len(srv.times)
+	srv.Unlock()
+	if requests != 1 || progress.Completed != 5 || progress.Failed != 4 {
+		t.Errorf("server requests = %v, progress = %+v, want 1 request and 4 of 5 failed", requests, progress)
+	}
+}
+
+func TestBatchStreamCancel(t *testing.T) {
+	srv := newBatchTestServer(0)
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queries := make(chan *PDQQuery)
+	results := New_Batch_Stream(ctx, queries, Batch_Config{Workers: 2})
+	for _, q := range srv.newQueries(2) {
+		queries <- q
+		if r := <-results; r.Err != nil || r.Query != q {
+			t.Errorf("stream result %v error = %v", r.Index, r.Err)
+		}
+	}
+	cancel()
+	select {
+	case r, ok := <-results:
+		if ok {
+			t.Errorf("stream result after cancel = %+v, want the results channel closed", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("results channel not closed after the context was cancelled")
+	}
+}
@@ -0,0 +1,284 @@
+package tukpdq
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	BULK_STATUS_MATCHED   = "matched"
+	BULK_STATUS_MULTIPLE  = "multiple"
+	BULK_STATUS_NOT_FOUND = "not found"
+	BULK_STATUS_ERROR     = "error"
+)
+
+// Bulk_Config maps CSV columns or NDJSON fields to PDQQuery fields. Template sets the server mode, url and OIDs of each query
+type Bulk_Config struct {
+	Columns  map[string]string `json:",omitempty"`
+	Template PDQQuery          `json:",omitempty"`
+}
+
+// BulkRecord is the outcome of a bulk query. Status is matched, multiple, not found or error and Patient is the first query patient
+type BulkRecord struct {
+	Index   int         `json:"index"`
+	Status  string      `json:"status"`
+	Error   string      `json:"error,omitempty"`
+	Count   int         `json:"count"`
+	Match   string      `json:"match,omitempty"`
+	Score   float64     `json:"score,omitempty"`
+	Patient *TUKPatient `json:"patient,omitempty"`
+	Issues  []string    `json:"issues,omitempty"`
+}
+
+var bulkQueryFields = map[string]func(q *PDQQuery, v string){
+	"nhsid":         func(q *PDQQuery, v string) { q.NHS_ID = v },
+	"nhsoid":        func(q *PDQQuery, v string) { q.NHS_OID = v },
+	"mrnid":         func(q *PDQQuery, v string) { q.MRN_ID = v },
+	"mrnoid":        func(q *PDQQuery, v string) { q.MRN_OID = v },
+	"regid":         func(q *PDQQuery, v string) { q.REG_ID = v },
+	"regoid":        func(q *PDQQuery, v string) { q.REG_OID = v },
+	"givenname":     func(q *PDQQuery, v string) { q.GivenName = v },
+	"familyname":    func(q *PDQQuery, v string) { q.FamilyName = v },
+	"birthdate":     func(q *PDQQuery, v string) { q.BirthDate = v },
+	"gender":        func(q *PDQQuery, v string) { q.Gender = v },
+	"zip":           func(q *PDQQuery, v string) { q.Zip = v },
+	"street":        func(q *PDQQuery, v string) { q.Street = v },
+	"town":          func(q *PDQQuery, v string) { q.Town = v },
+	"city":          func(q *PDQQuery, v string) { q.City = v },
+	"country":       func(q *PDQQuery, v string) { q.Country = v },
+	"delphilocalid": func(q *PDQQuery, v string) { q.Delphi_Local_ID = v },
+}
+var bulkColumnAliases = map[string]string{
+	"nhs":         "nhsid",
+	"nhsnumber":   "nhsid",
+	"nhsno":       "nhsid",
+	"mrn":         "mrnid",
+	"pid":         "mrnid",
+	"forename":    "givenname",
+	"firstname":   "givenname",
+	"given":       "givenname",
+	"surname":     "familyname",
+	"lastname":    "familyname",
+	"family":      "familyname",
+	"dob":         "birthdate",
+	"dateofbirth": "birthdate",
+	"sex":         "gender",
+	"postcode":    "zip",
+	"postalcode":  "zip",
+}
+
+// Read_CSV_Queries returns a query for each row of the CSV. The first row is the column headers
+func Read_CSV_Queries(r io.Reader, cfg Bulk_Config) ([]*PDQQuery, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.New("invalid request - unable to read csv header - " + err.Error())
+	}
+	setters, err := cfg.setters(header)
+	if err != nil {
+		return nil, err
+	}
+	var queries []*PDQQuery
+	for row := 2; ; row++ {
+		values, err := cr.Read()
+		if err == io.EOF {
+			return queries, nil
+		}
+		if err != nil {
+			return nil, errors.New("invalid request - csv row " + strconv.Itoa(row) + " - " + err.Error())
+		}
+		q := newQueryFrom(cfg.Template)
+		for n, value := range values {
+			if n < len(setters) && setters[n] != nil {
+				setters[n](q, strings.TrimSpace(value))
+			}
+		}
+		queries = append(queries, q)
+	}
+}
+
+// Read_NDJSON_Queries returns a query for each line of the newline delimited JSON. Each line is an object of field names and values
+func Read_NDJSON_Queries(r io.Reader, cfg Bulk_Config) ([]*PDQQuery, error) {
+	var queries []*PDQQuery
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		fields := make(map[string]interface{})
+		dec := json.NewDecoder(strings.NewReader(scanner.Text()))
+		dec.UseNumber()
+		if err := dec.Decode(&fields); err != nil {
+			return nil, errors.New("invalid request - ndjson line " + strconv.Itoa(line) + " - " + err.Error())
+		}
+		q := newQueryFrom(cfg.Template)
+		for name, value := range fields {
+			setter, err := cfg.setter(name)
+			if err != nil {
+				return nil, err
+			}
+			if setter != nil && value != nil {
+				setter(q, strings.TrimSpace(fmt.Sprint(value)))
+			}
+		}
+		queries = append(queries, q)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New("invalid request - unable to read ndjson - " + err.Error())
+	}
+	return queries, nil
+}
+
+// setters returns the query field setter for each column. Columns that do not map to a query field have a nil setter
+func (cfg Bulk_Config) setters(columns []string) ([]func(q *PDQQuery, v string), error) {
+	setters := make([]func(q *PDQQuery, v string), len(columns))
+	for n, column := range columns {
+		setter, err := cfg.setter(column)
+		if err != nil {
+			return nil, err
+		}
+		setters[n] = setter
+	}
+	return setters, nil
+}
+
+// setter returns the query field setter for the column, or nil if the column is not a query field
+func (cfg Bulk_Config) setter(column string) (func(q *PDQQuery, v string), error) {
+	if field, ok := cfg.Columns[column]; ok {
+		if setter, ok := bulkQueryFields[bulkFieldKey(field)]; ok {
+			return setter, nil
+		}
+		return nil, errors.New("invalid configuration - column " + column + " is mapped to unknown query field " + field)
+	}
+	key := bulkFieldKey(column)
+	if alias, ok := bulkColumnAliases[key]; ok {
+		key = alias
+	}
+	return bulkQueryFields[key], nil
+}
+func bulkFieldKey(name string) string {
+	return strings.NewReplacer("_", "", " ", "", "-", "", ".", "").Replace(strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))))
+}
+
+// newQueryFrom returns a copy of the template query without the results of any earlier query
+func newQueryFrom(template PDQQuery) *PDQQuery {
+	q := template
+	q.Identifiers = append([]PatientID(nil), template.Identifiers...)
+	q.Target_Domains = append([]string(nil), template.Target_Domains...)
+	q.Used_PID, q.Used_PID_OID = "", ""
+	q.Request, q.Response, q.StatusCode, q.Count = nil, nil, 0, 0
+	q.PDQv3Response, q.PIXv3Response, q.PIXmResponse = nil, nil, nil
+	q.CGLUserResponse, q.DelphiResponse, q.OperationOutcome = nil, nil, nil
+	q.Patients, q.Issues, q.Patient_Groups = nil, nil, nil
+	return &q
+}
+
+// New_Bulk_Record returns the outcome of a batch query. A query the server answered with http status 404 or 204 is not found
+func New_Bulk_Record(rsp BatchResult) BulkRecord {
+	rec := BulkRecord{Index: rsp.Index, Status: BULK_STATUS_NOT_FOUND}
+	q := rsp.Query
+	switch {
+	case q != nil && (q.StatusCode == http.StatusNotFound || q.StatusCode == http.StatusNoContent):
+	case rsp.Err != nil:
+		rec.Status, rec.Error = BULK_STATUS_ERROR, rsp.Err.Error()
+	case q == nil:
+		rec.Status, rec.Error = BULK_STATUS_ERROR, "query is nil"
+	case q.StatusCode != 0 && q.StatusCode != http.StatusOK:
+		rec.Status, rec.Error = BULK_STATUS_ERROR, "server returned http status "+strconv.Itoa(q.StatusCode)
+	}
+	if q == nil {
+		return rec
+	}
+	rec.Issues = q.Issues
+	if q.Patients != nil && len(*q.Patients) > 0 {
+		rec.Count = len(*q.Patients)
+		pat := (*q.Patients)[0]
+		rec.Patient = &pat
+		if pat.Match != nil {
+			rec.Match, rec.Score = pat.Match.Classification, pat.Match.Score
+		} else if pat.MatchScore > 0 {
+			rec.Score = pat.MatchScore
+		}
+		if rec.Status != BULK_STATUS_ERROR {
+			rec.Status = BULK_STATUS_MATCHED
+			if rec.Count > 1 {
+				rec.Status = BULK_STATUS_MULTIPLE
+			}
+		}
+	}
+	return rec
+}
+
+var bulkCSVHeader = []string{"index", "status", "error", "count", "match", "score", "nhsid", "pid", "pidoid", "regid", "givenname", "familyname", "birthdate", "gender", "street", "town", "city", "zip", "country", "issues"}
+
+// BulkWriter writes batch results to a bulk output file
+type BulkWriter interface {
+	Write(rsp BatchResult) error
+	Flush() error
+}
+
+// BulkCSVWriter writes batch results as CSV rows with a header row
+type BulkCSVWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+// New_Bulk_CSV_Writer returns a BulkCSVWriter that writes to w
+func New_Bulk_CSV_Writer(w io.Writer) *BulkCSVWriter {
+	return &BulkCSVWriter{w: csv.NewWriter(w)}
+}
+
+// Write writes the batch result as a CSV row, writing the header row first if it has not been written
+func (bw *BulkCSVWriter) Write(rsp BatchResult) error {
+	if !bw.header {
+		if err := bw.w.Write(bulkCSVHeader); err != nil {
+			return err
+		}
+		bw.header = true
+	}
+	rec := New_Bulk_Record(rsp)
+	pat := TUKPatient{}
+	if rec.Patient != nil {
+		pat = *rec.Patient
+	}
+	score := ""
+	if rec.Score > 0 {
+		score = strconv.FormatFloat(rec.Score, 'f', -1, 64)
+	}
+	return bw.w.Write([]string{strconv.Itoa(rec.Index), rec.Status, rec.Error, strconv.Itoa(rec.Count), rec.Match, score, pat.NHSID, pat.PID, pat.PIDOID, pat.REGID, pat.GivenName, pat.FamilyName, pat.BirthDate, pat.Gender, pat.Street, pat.Town, pat.City, pat.Zip, pat.Country, strings.Join(rec.Issues, "; ")})
+}
+
+// Flush writes any buffered rows and returns any write error
+func (bw *BulkCSVWriter) Flush() error {
+	bw.w.Flush()
+	return bw.w.Error()
+}
+
+// BulkNDJSONWriter writes batch results as newline delimited JSON BulkRecords
+type BulkNDJSONWriter struct {
+	enc *json.Encoder
+}
+
+// New_Bulk_NDJSON_Writer returns a BulkNDJSONWriter that writes to w
+func New_Bulk_NDJSON_Writer(w io.Writer) *BulkNDJSONWriter {
+	return &BulkNDJSONWriter{enc: json.NewEncoder(w)}
+}
+
+// Write writes the batch result as a JSON BulkRecord line
+func (bw *BulkNDJSONWriter) Write(rsp BatchResult) error {
+	return bw.enc.Encode(New_Bulk_Record(rsp))
+}
+
+// Flush is provided so that the NDJSON and CSV writers can be used interchangeably. Each record is written when Write is called
+func (bw *BulkNDJSONWriter) Flush() error {
+	return nil
+}
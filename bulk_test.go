@@ -0,0 +1,203 @@
+package tukpdq
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewQueryFrom(t *testing.T) {
+	template := PDQQuery{
+		Server_Mode:    "pixm",
+		Identifiers:    []PatientID{New_PatientID("1.2.3", "M1")},
+		Target_Domains: []string{"1.2.3"},
+		Used_PID:       "M1",
+		Patients:       &[]TUKPatient{{NHSID: "9999999468"}},
+		Issues:         []string{"earlier issue"},
+		Count:          1,
+	}
+	q := newQueryFrom(template)
+	q.Identifiers[0].Value = "M2"
+	q.Target_Domains[0] = "1.2.4"
+	if template.Identifiers[0].Value != "M1" || template.Target_Domains[0] != "1.2.3" {
+		t.Errorf("template changed, Identifiers = %+v, Target_Domains = %v", template.Identifiers, template.Target_Domains)
+	}
+	if q.Server_Mode != "pixm" || q.Patients != nil || q.Issues != nil || q.Count != 0 || q.Used_PID != "" {
+		t.Errorf("newQueryFrom() = %+v, want the template settings without results", q)
+	}
+}
+
+func TestReadCSVQueries(t *testing.T) {
+	cfg := Bulk_Config{
+		Columns:  map[string]string{"Hospital Number": "MRN_ID"},
+		Template: PDQQuery{Server_Mode: "pixm", Server_URL: "https://pix.example.nhs.uk/fhir/Patient", REG_OID: "2.16.840.1.113883.2.1.3.31.2.1.1", MRN_OID: "1.2.3"},
+	}
+	csvData := "\ufeffNHS Number,Surname, Forename,DOB,Sex,Post-code,Hospital Number,Notes,nhs_oid\n" +
+		"943 476 5919,Bloggs,Fred,19700102,M,LS1 4AP,M1,first,\n" +
+		"\"\",\"O'Brien, Jr\",Jane,1980-02-03,F,,M2,second,2.16.840.1.113883.2.1.4.1\n"
+	queries, err := Read_CSV_Queries(strings.NewReader(csvData), cfg)
+	if err != nil {
+		t.Fatalf("Read_CSV_Queries() error = %v", err)
+	}
+	want := []PDQQuery{
+		{NHS_ID: "943 476 5919", FamilyName: "Bloggs", GivenName: "Fred", BirthDate: "19700102", Gender: "M", Zip: "LS1 4AP", MRN_ID: "M1"},
+		{FamilyName: "O'Brien, Jr", GivenName: "Jane", BirthDate: "1980-02-03", Gender: "F", MRN_ID: "M2", NHS_OID: "2.16.840.1.113883.2.1.4.1"},
+	}
+	if len(queries) != len(want) {
+		t.Fatalf("Read_CSV_Queries() = %v queries, want %v", len(queries), len(want))
+	}
+	for n, q := range queries {
+		w := want[n]
+		if q.NHS_ID != w.NHS_ID || q.FamilyName != w.FamilyName || q.GivenName != w.GivenName || q.BirthDate != w.BirthDate || q.Gender != w.Gender ||
+			q.Zip != w.Zip || q.MRN_ID != w.MRN_ID || q.NHS_OID != w.NHS_OID {
+			t.Errorf("query %v = %+v, want %+v", n, q, w)
+		}
+		if q.Server_Mode != "pixm" || q.REG_OID != cfg.Template.REG_OID || q.MRN_OID != "1.2.3" {
+			t.Errorf("query %v = %+v, want the template settings", n, q)
+		}
+	}
+	tests := []struct {
+		name string
+		cfg  Bulk_Config
+		csv  string
+		err  string
+	}{
+		{"empty", Bulk_Config{}, "", "unable to read csv header"},
+		{"unknown mapped field", Bulk_Config{Columns: map[string]string{"Hospital Number": "Hospital_ID"}}, "Hospital Number\nM1\n", "mapped to unknown query field Hospital_ID"},
+		{"wrong number of fields", Bulk_Config{}, "nhs,surname\n9434765919,Bloggs\n9999999468\n", "csv row 3"},
+		{"bare quote", Bulk_Config{}, "nhs,surname\n9434765919,Blo\"ggs\n", "csv row 2"},
+	}
+	for _, tt := range tests {
+		if _, err := Read_CSV_Queries(strings.NewReader(tt.csv), tt.cfg); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: Read_CSV_Queries() error = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestReadNDJSONQueries(t *testing.T) {
+	cfg := Bulk_Config{Columns: map[string]string{"hospitalNumber": "MRN_ID"}, Template: PDQQuery{Server_Mode: "pdqv3"}}
+	ndjson := `{"nhsNumber": 9434765919, "surname": "Bloggs", "dateOfBirth": "19700102", "hospitalNumber": "M1", "notes": {"a": 1}}` + "\n" +
+		"\n" +
+		`{"Family_Name": " Jones ", "given": "Jane", "postcode": "LS1 4AP", "NHS_ID": null}` + "\n"
+	queries, err := Read_NDJSON_Queries(strings.NewReader(ndjson), cfg)
+	if err != nil {
+		t.Fatalf("Read_NDJSON_Queries() error = %v", err)
+	}
+	if len(queries) != 2 {
+		t.Fatalf("Read_NDJSON_Queries() = %v queries, want 2", len(queries))
+	}
+	if q := queries[0]; q.NHS_ID != "9434765919" || q.FamilyName != "Bloggs" || q.BirthDate != "19700102" || q.MRN_ID != "M1" || q.Server_Mode != "pdqv3" {
+		t.Errorf("query 0 = %+v", q)
+	}
+	if q := queries[1]; q.NHS_ID != "" || q.FamilyName != "Jones" || q.GivenName != "Jane" || q.Zip != "LS1 4AP" || q.Server_Mode != "pdqv3" {
+		t.Errorf("query 1 = %+v", q)
+	}
+	tests := []struct {
+		name   string
+		cfg    Bulk_Config
+		ndjson string
+		err    string
+	}{
+		{"bad json", Bulk_Config{}, "{\"nhs\": \"9434765919\"}\n{\"nhs\": \n", "ndjson line 2"},
+		{"not an object", Bulk_Config{}, "[\"9434765919\"]\n", "ndjson line 1"},
+		{"unknown mapped field", Bulk_Config{Columns: map[string]string{"hospitalNumber": "Hospital_ID"}}, "{\"hospitalNumber\": \"M1\"}\n", "mapped to unknown query field Hospital_ID"},
+	}
+	for _, tt := range tests {
+		if _, err := Read_NDJSON_Queries(strings.NewReader(tt.ndjson), tt.cfg); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: Read_NDJSON_Queries() error = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func newBulkTestResults() []BatchResult {
+	matched := []TUKPatient{{NHSID: "9434765919", GivenName: "Fred", FamilyName: "Bloggs", Zip: "LS1 4AP", Match: &MatchResult{Score: 92.5, Classification: MATCH_RESULT_MATCH}}}
+	multiple := []TUKPatient{{NHSID: "9434765919", MatchScore: 80}, {NHSID: "9999999468"}}
+	return []BatchResult{
+		{Index: 0, Query: &PDQQuery{StatusCode: http.StatusOK, Patients: &matched, Issues: []string{"first issue", "second issue"}}},
+		{Index: 1, Query: &PDQQuery{StatusCode: http.StatusOK, Patients: &multiple}},
+		{Index: 2, Query: &PDQQuery{StatusCode: http.StatusOK, Patients: &[]TUKPatient{}}},
+		{Index: 3, Query: &PDQQuery{StatusCode: http.StatusNotFound}, Err: &OutcomeError{StatusCode: http.StatusNotFound, Outcome: OUTCOME_SOURCE_IDENTIFIER_NOT_FOUND}},
+		{Index: 4, Query: &PDQQuery{StatusCode: http.StatusNoContent}},
+		{Index: 5, Query: &PDQQuery{StatusCode: http.StatusBadGateway}},
+		{Index: 6, Query: &PDQQuery{}, Err: &ValidationError{Field: "nhs id", Value: "1234567890", Reason: "has an invalid check digit"}},
+		{Index: 7},
+	}
+}
+
+func TestNewBulkRecord(t *testing.T) {
+	want := []struct {
+		status string
+		count  int
+		match  string
+		score  float64
+		err    bool
+	}{
+		{BULK_STATUS_MATCHED, 1, MATCH_RESULT_MATCH, 92.5, false},
+		{BULK_STATUS_MULTIPLE, 2, "", 80, false},
+		{BULK_STATUS_NOT_FOUND, 0, "", 0, false},
+		{BULK_STATUS_NOT_FOUND, 0, "", 0, false},
+		{BULK_STATUS_NOT_FOUND, 0, "", 0, false},
+		{BULK_STATUS_ERROR, 0, "", 0, true},
+		{BULK_STATUS_ERROR, 0, "", 0, true},
+		{BULK_STATUS_ERROR, 0, "", 0, true},
+	}
+	for n, rsp := range newBulkTestResults() {
+		rec := New_Bulk_Record(rsp)
+		w := want[n]
+		if rec.Index != n || rec.Status != w.status || rec.Count != w.count || rec.Match != w.match || rec.Score != w.score || (rec.Error != "") != w.err {
+			t.Errorf("New_Bulk_Record(%v) = %+v, want %+v", n, rec, w)
+		}
+	}
+}
+
+func TestBulkWriters(t *testing.T) {
+	results := newBulkTestResults()
+	var csvOut, ndjsonOut bytes.Buffer
+	for _, w := range []BulkWriter{New_Bulk_CSV_Writer(&csvOut), New_Bulk_NDJSON_Writer(&ndjsonOut)} {
+		for _, rsp := range results {
+			if err := w.Write(rsp); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("Flush() error = %v", err)
+		}
+	}
+	rows, err := csv.NewReader(&csvOut).ReadAll()
+	if err != nil {
+		t.Fatalf("csv output error = %v\n%s", err, csvOut.String())
+	}
+	if len(rows) != len(results)+1 || !reflect.DeepEqual(rows[0], bulkCSVHeader) {
+		t.Fatalf("csv output = %v rows, header %v", len(rows), rows[0])
+	}
+	col := make(map[string]int)
+	for n, name := range rows[0] {
+		col[name] = n
+	}
+	first := rows[1]
+	if first[col["index"]] != "0" || first[col["status"]] != BULK_STATUS_MATCHED || first[col["count"]] != "1" || first[col["match"]] != MATCH_RESULT_MATCH ||
+		first[col["score"]] != "92.5" || first[col["nhsid"]] != "9434765919" || first[col["familyname"]] != "Bloggs" || first[col["zip"]] != "LS1 4AP" ||
+		first[col["issues"]] != "first issue; second issue" {
+		t.Errorf("csv row 1 = %v", first)
+	}
+	if row := rows[7]; row[col["status"]] != BULK_STATUS_ERROR || !strings.Contains(row[col["error"]], "invalid check digit") || row[col["score"]] != "" {
+		t.Errorf("csv row 7 = %v", row)
+	}
+	dec := json.NewDecoder(&ndjsonOut)
+	for n, rsp := range results {
+		var rec BulkRecord
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf("ndjson line %v error = %v", n+1, err)
+		}
+		if want := New_Bulk_Record(rsp); !reflect.DeepEqual(rec, want) {
+			t.Errorf("ndjson line %v = %+v, want %+v", n+1, rec, want)
+		}
+	}
+	if dec.More() {
+		t.Error("ndjson output has more records than results")
+	}
+}
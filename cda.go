@@ -0,0 +1,233 @@
+package tukpdq
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+)
+
+const (
+	HL7_ADMINISTRATIVE_GENDER_OID = "2.16.840.1.113883.5.1"
+	HL7_NULL_FLAVOR_UNKNOWN       = "UNK"
+)
+
+// CDARecordTarget is a CDA R2 recordTarget with the patientRole of the document subject
+type CDARecordTarget struct {
+	XMLName            xml.Name       `xml:"recordTarget"`
+	TypeCode           string         `xml:"typeCode,attr"`
+	ContextControlCode string         `xml:"contextControlCode,attr"`
+	PatientRole        CDAPatientRole `xml:"patientRole"`
+}
+type CDAPatientRole struct {
+	ClassCode string       `xml:"classCode,attr"`
+	ID        []HL7V3II    `xml:"id"`
+	Addr      []CDAAddr    `xml:"addr,omitempty"`
+	Telecom   []CDATelecom `xml:"telecom,omitempty"`
+	Patient   CDAPatient   `xml:"patient"`
+}
+type CDAAddr struct {
+	Use               string   `xml:"use,attr,omitempty"`
+	StreetAddressLine []string `xml:"streetAddressLine,omitempty"`
+	City              string   `xml:"city,omitempty"`
+	County            string   `xml:"county,omitempty"`
+	State             string   `xml:"state,omitempty"`
+	PostalCode        string   `xml:"postalCode,omitempty"`
+	Country           string   `xml:"country,omitempty"`
+}
+type CDATelecom struct {
+	Use   string `xml:"use,attr,omitempty"`
+	Value string `xml:"value,attr"`
+}
+type CDAPatient struct {
+	ClassCode                string    `xml:"classCode,attr"`
+	DeterminerCode           string    `xml:"determinerCode,attr"`
+	Name                     []CDAName `xml:"name"`
+	AdministrativeGenderCode CDACode   `xml:"administrativeGenderCode"`
+	BirthTime                CDAValue  `xml:"birthTime"`
+}
+type CDAName struct {
+	NullFlavor string   `xml:"nullFlavor,attr,omitempty"`
+	Use        string   `xml:"use,attr,omitempty"`
+	Prefix     []string `xml:"prefix,omitempty"`
+	Given      []string `xml:"given,omitempty"`
+	Family     string   `xml:"family,omitempty"`
+	Suffix     []string `xml:"suffix,omitempty"`
+}
+type CDACode struct {
+	NullFlavor string `xml:"nullFlavor,attr,omitempty"`
+	Code       string `xml:"code,attr,omitempty"`
+	CodeSystem string `xml:"codeSystem,attr,omitempty"`
+}
+type CDAValue struct {
+	NullFlavor string `xml:"nullFlavor,attr,omitempty"`
+	Value      string `xml:"value,attr,omitempty"`
+}
+
+// CDA_Record_Target returns the CDA R2 recordTarget for the patient
+func (p *TUKPatient) CDA_Record_Target() CDARecordTarget {
+	rt := CDARecordTarget{
+		TypeCode:           "RCT",
+		ContextControlCode: "OP",
+		PatientRole: CDAPatientRole{
+			ClassCode: "PAT",
+			Patient: CDAPatient{
+				ClassCode:                "PSN",
+				DeterminerCode:           "INSTANCE",
+				AdministrativeGenderCode: CDACode{NullFlavor: HL7_NULL_FLAVOR_UNKNOWN},
+				BirthTime:                CDAValue{NullFlavor: HL7_NULL_FLAVOR_UNKNOWN},
+			},
+		},
+	}
+	role := &rt.PatientRole
+	ids := []PatientID{
+		{Value: p.NHSID, Authority: Authority_From_OID(p.NHSOID)},
+		p.pidID(),
+		{Value: p.REGID, Authority: Authority_From_OID(p.REGOID)},
+	}
+	for _, id := range append(ids, p.Identifiers...) {
+		if id.Value == "" || !isOID(id.Authority.OID) {
+			continue
+		}
+		ii := HL7V3II{Root: id.Authority.OID, Extension: id.Value, AssigningAuthorityName: id.Authority.Name}
+		dup := false
+		for _, rid := range role.ID {
+			dup = dup || (rid.Root == ii.Root && rid.Extension == ii.Extension)
+		}
+		if !dup {
+			role.ID = append(role.ID, ii)
+		}
+	}
+	if len(role.ID) == 0 {
+		role.ID = []HL7V3II{{NullFlavor: HL7_NULL_FLAVOR_UNKNOWN}}
+	}
+	addrs := p.Addresses
+	if len(addrs) == 0 && countSet(p.Street, p.Town, p.City, p.State, p.Zip, p.Country) > 0 {
+		addrs = []Address{{Use: "home", Line: []string{p.Street, p.Town}, City: p.City, State: p.State, PostalCode: p.Zip, Country: p.Country}}
+	}
+	for _, addr := range addrs {
+		a := CDAAddr{Use: cdaAddressUse(addr.Use, addr.Type), City: addr.City, County: addr.District, State: addr.State, PostalCode: addr.PostalCode, Country: addr.Country}
+		for _, line := range addr.Line {
+			if strings.TrimSpace(line) != "" {
+				a.StreetAddressLine = append(a.StreetAddressLine, line)
+			}
+		}
+		role.Addr = append(role.Addr, a)
+	}
+	for _, tel := range p.Telecom {
+		if tel.Value != "" {
+			role.Telecom = append(role.Telecom, CDATelecom{Use: cdaTelecomUse(tel.Use), Value: cdaTelecomValue(tel)})
+		}
+	}
+	names := p.Names
+	if len(names) == 0 && (p.GivenName != "" || p.FamilyName != "") {
+		names = []HumanName{{Given: strings.Fields(p.GivenName), Family: p.FamilyName}}
+	}
+	for _, name := range names {
+		role.Patient.Name = append(role.Patient.Name, CDAName{Use: cdaNameUse(name.Use), Prefix: name.Prefix, Given: name.Given, Family: name.Family, Suffix: name.Suffix})
+	}
+	if len(role.Patient.Name) == 0 {
+		role.Patient.Name = []CDAName{{NullFlavor: HL7_NULL_FLAVOR_UNKNOWN}}
+	}
+	if code := cdaGender(p.Gender); code != "" {
+		role.Patient.AdministrativeGenderCode = CDACode{Code: code, CodeSystem: HL7_ADMINISTRATIVE_GENDER_OID}
+	}
+	if p.BirthDate != "" {
+		role.Patient.BirthTime = CDAValue{Value: strings.ReplaceAll(p.BirthDate, "-", "")}
+	}
+	return rt
+}
+
+// CDA_Record_Target returns the CDA R2 recordTarget for the active patient the query resolved to
+func (i *PDQQuery) CDA_Record_Target() (CDARecordTarget, error) {
+	pat, ok := i.resolvedPatient()
+	if !ok {
+		return CDARecordTarget{}, errors.New("invalid request - the query did not resolve to a single active patient")
+	}
+	if i.NHS_ID != "" && i.NHS_OID != "" {
+		pat.NHSOID, pat.NHSID = i.NHS_OID, i.NHS_ID
+	}
+	if i.MRN_ID != "" && i.MRN_OID != "" {
+		pat.PIDOID, pat.PID = i.MRN_OID, i.MRN_ID
+	}
+	if i.REG_ID != "" && i.REG_OID != "" {
+		pat.REGOID, pat.REGID = i.REG_OID, i.REG_ID
+	}
+	return pat.CDA_Record_Target(), nil
+}
+
+// cdaGender returns the HL7 AdministrativeGender code for a FHIR or HL7 v3 gender, or "" if unknown
+func cdaGender(gender string) string {
+	switch normalisedGender(gender) {
+	case "male":
+		return "M"
+	case "female":
+		return "F"
+	case "other":
+		return "UN"
+	}
+	return ""
+}
+
+// cdaNameUse returns the HL7 v3 EntityNameUse code for a FHIR name use
+func cdaNameUse(use string) string {
+	switch use {
+	case "official", "usual":
+		return "L"
+	case "nickname":
+		return "P"
+	}
+	return ""
+}
+
+// cdaAddressUse returns the HL7 v3 PostalAddressUse codes for a FHIR address use and type
+func cdaAddressUse(use string, addrType string) string {
+	var codes []string
+	switch use {
+	case "home":
+		codes = append(codes, "H")
+	case "work":
+		codes = append(codes, "WP")
+	case "temp":
+		codes = append(codes, "TMP")
+	case "old":
+		codes = append(codes, "OLD")
+	}
+	switch addrType {
+	case "postal":
+		codes = append(codes, "PST")
+	case "physical":
+		codes = append(codes, "PHYS")
+	}
+	return strings.Join(codes, " ")
+}
+
+// cdaTelecomUse returns the HL7 v3 TelecommunicationAddressUse code for a FHIR contact point use
+func cdaTelecomUse(use string) string {
+	switch use {
+	case "home":
+		return "HP"
+	case "work":
+		return "WP"
+	case "mobile":
+		return "MC"
+	case "temp":
+		return "TMP"
+	}
+	return ""
+}
+
+// cdaTelecomValue returns the TEL url of a contact point, tel:, fax: or mailto: followed by the value. Url values are returned unchanged
+func cdaTelecomValue(tel Telecom) string {
+	if strings.Contains(tel.Value, ":") {
+		return tel.Value
+	}
+	switch tel.System {
+	case "phone":
+		return "tel:" + strings.ReplaceAll(tel.Value, " ", "")
+	case "fax":
+		return "fax:" + strings.ReplaceAll(tel.Value, " ", "")
+	case "email":
+		return "mailto:" + tel.Value
+	}
+	return tel.Value
+}
@@ -0,0 +1,184 @@
+package tukpdq
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ipthomas/tukhttp"
+)
+
+const CGL_LOCAL_IDENTIFIER = "CGL Local Identifier"
+
+// CGLSummary lists the flagged risks, safeguarding indicators and positive drug tests of a CGL client
+type CGLSummary struct {
+	Key_Worker        CGLKeyWorker `json:"keyworker"`
+	Next_Appointment  string       `json:"nextappointment,omitempty"`
+	Last_Engagement   string       `json:"lastengagement,omitempty"`
+	Last_Face_To_Face string       `json:"lastfacetoface,omitempty"`
+	BBV               CGLBBV       `json:"bbv"`
+	Drug_Test         CGLDrugTest  `json:"drugtest"`
+	Prescribing       []string     `json:"prescribing,omitempty"`
+	Risks             []string     `json:"risks,omitempty"`
+	Risks_Reported    string       `json:"risksreported,omitempty"`
+	Safeguarding      []string     `json:"safeguarding,omitempty"`
+	Safeguarding_Date string       `json:"safeguardingdate,omitempty"`
+}
+type CGLKeyWorker struct {
+	Local_ID string `json:"localid,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Telecom  string `json:"telecom,omitempty"`
+}
+type CGLBBV struct {
+	Tested         bool   `json:"tested"`
+	HepC_Result    string `json:"hepcresult,omitempty"`
+	HepC_Last_Test string `json:"hepclasttest,omitempty"`
+	HIV_Positive   bool   `json:"hivpositive"`
+}
+type CGLDrugTest struct {
+	Date     string   `json:"date,omitempty"`
+	Sample   string   `json:"sample,omitempty"`
+	Status   string   `json:"status,omitempty"`
+	Type     string   `json:"type,omitempty"`
+	Positive []string `json:"positive,omitempty"`
+}
+
+// Summary returns the key worker, appointment and engagement dates and the BBV, drug test, risk and safeguarding flags of the CGL client
+func (r *CGLUserResponse) Summary() CGLSummary {
+	client := r.Data.Client
+	kw := r.Data.KeyWorker
+	s := CGLSummary{
+		Key_Worker: CGLKeyWorker{
+			Name:    strings.TrimSpace(kw.Name.Given + " " + kw.Name.Family),
+			Telecom: kw.Telecom,
+		},
+		Next_Appointment:  client.BasicDetails.NextCGLAppointmentDate,
+		Last_Engagement:   client.BasicDetails.LastEngagementByCGLDate,
+		Last_Face_To_Face: client.BasicDetails.LastFaceToFaceEngagementDate,
+		BBV: CGLBBV{
+			Tested:         isCGLFlag(client.BbvInformation.BbvTested),
+			HepC_Result:    client.BbvInformation.HepCResult,
+			HepC_Last_Test: client.BbvInformation.HepCLastTestDate,
+			HIV_Positive:   isCGLFlag(client.BbvInformation.HivPositive),
+		},
+		Drug_Test: CGLDrugTest{
+			Date:     client.DrugTestResults.DrugTestDate,
+			Sample:   client.DrugTestResults.DrugTestSample,
+			Status:   client.DrugTestResults.DrugTestStatus,
+			Type:     client.DrugTestResults.InstantOrConfirmation,
+			Positive: cglFlags(client.DrugTestResults.Results, false),
+		},
+		Prescribing:       client.PrescribingInformation,
+		Risks:             cglFlags(client.RiskInformation, true),
+		Risks_Reported:    client.RiskInformation.LastSelfReportedDate,
+		Safeguarding:      cglFlags(client.SafeguardingInformation, false),
+		Safeguarding_Date: client.SafeguardingInformation.LastReviewDate,
+	}
+	if kw.LocalIdentifier != 0 {
+		s.Key_Worker.Local_ID = strconv.Itoa(kw.LocalIdentifier)
+	}
+	return s
+}
+
+// cglFlags returns the sorted json names of the flagged values in a CGL response section
+func cglFlags(section interface{}, nested bool) []string {
+	var flags []string
+	b, _ := json.Marshal(section)
+	if nested {
+		domains := make(map[string]json.RawMessage)
+		json.Unmarshal(b, &domains)
+		for domain, raw := range domains {
+			values := make(map[string]string)
+			if json.Unmarshal(raw, &values) == nil {
+				for _, flag := range flaggedValues(values) {
+					flags = append(flags, domain+"."+flag)
+				}
+			}
+		}
+	} else {
+		values := make(map[string]string)
+		json.Unmarshal(b, &values)
+		flags = flaggedValues(values)
+	}
+	sort.Strings(flags)
+	return flags
+}
+func flaggedValues(values map[string]string) []string {
+	var flags []string
+	for name, value := range values {
+		if name != "noIdentifiedRisk" && !strings.HasSuffix(name, "Date") && isCGLFlag(value) {
+			flags = append(flags, name)
+		}
+	}
+	return flags
+}
+
+// isCGLFlag returns true for the CGL values that set a flag, yes, y, true, positive or detected
+func isCGLFlag(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "yes", "y", "true", "positive", "detected":
+		return true
+	}
+	return false
+}
+
+// cglProvider queries the CGL API for the client with the query NHS id
+type cglProvider struct{}
+
+func (cglProvider) New_Request(i *PDQQuery) (*tukhttp.HTTPRequest, error) {
+	return &tukhttp.HTTPRequest{
+		Method:       http.MethodGet,
+		URL:          i.Server_URL + i.NHS_ID,
+		X_Api_Key:    i.CGL_X_Api_Key,
+		X_Api_Secret: i.CGL_X_Api_Secret,
+		Timeout:      i.Timeout,
+		DebugMode:    i.DebugMode,
+	}, nil
+}
+func (cglProvider) Send(i *PDQQuery, httpReq *tukhttp.HTTPRequest) error {
+	return i.newHTTPRequest(httpReq)
+}
+func (cglProvider) Map_Patients(i *PDQQuery, rsp []byte) ([]TUKPatient, error) {
+	if err := json.Unmarshal(rsp, &i.CGLUserResponse); err != nil {
+		return nil, err
+	}
+	if i.CGLUserResponse.Data.Client.BasicDetails == (CGLUserResponse{}).Data.Client.BasicDetails {
+		return nil, nil
+	}
+	return []TUKPatient{i.newCGLPatient()}, nil
+}
+
+// newCGLPatient returns the CGL client basic details as a TUKPatient with the client summary
+func (i *PDQQuery) newCGLPatient() TUKPatient {
+	details := i.CGLUserResponse.Data.Client.BasicDetails
+	pat := TUKPatient{
+		GivenName:  details.Name.Given,
+		FamilyName: details.Name.Family,
+		BirthDate:  strings.ReplaceAll(details.BirthDate, "-", ""),
+		Gender:     normalisedGender(details.SexAtBirth),
+	}
+	if details.NhsNumber != "" {
+		pat.addID(i, PatientID{Value: details.NhsNumber, Authority: Authority_From_OID(i.NHS_OID)})
+	}
+	if details.LocalIdentifier != 0 {
+		pat.addID(i, PatientID{Value: strconv.Itoa(details.LocalIdentifier), Authority: AssigningAuthority{Name: CGL_LOCAL_IDENTIFIER}})
+	}
+	if details.Name.Given != "" || details.Name.Family != "" {
+		pat.Names = []HumanName{{Given: strings.Fields(details.Name.Given), Family: details.Name.Family}}
+	}
+	addr := Address{PostalCode: details.Address.PostCode}
+	for _, line := range []string{details.Address.AddressLine1, details.Address.AddressLine2, details.Address.AddressLine3, details.Address.AddressLine4, details.Address.AddressLine5} {
+		if strings.TrimSpace(line) != "" {
+			addr.Line = append(addr.Line, line)
+		}
+	}
+	if len(addr.Line) > 0 || addr.PostalCode != "" {
+		pat.Addresses = []Address{addr}
+	}
+	pat.setFlatFields()
+	summary := i.CGLUserResponse.Summary()
+	pat.CGLSummary = &summary
+	return pat
+}
@@ -0,0 +1,118 @@
+package tukpdq
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ipthomas/tukcnst"
+)
+
+const cglClientResponse = `{
+	"data": {
+		"client": {
+			"basicDetails": {
+				"address": {"addressLine1": "1 Test Street", "addressLine2": "Headingley", "addressLine3": " ", "postCode": "LS6 2BB"},
+				"birthDate": "1970-01-02",
+				"lastEngagementByCGLDate": "2024-03-01",
+				"lastFaceToFaceEngagementDate": "2024-02-14",
+				"localIdentifier": 123456,
+				"name": {"family": "Bloggs", "given": "Fred John"},
+				"nextCGLAppointmentDate": "2024-04-01",
+				"nhsNumber": "9999999468",
+				"sexAtBirth": "Male"
+			},
+			"bbvInformation": {"bbvTested": "Yes", "hepCLastTestDate": "2023-11-01", "hepCResult": "Negative", "hivPositive": "No"},
+			"drugTestResults": {
+				"drugTestDate": "2024-02-14",
+				"drugTestSample": "Urine",
+				"drugTestStatus": "Complete",
+				"instantOrConfirmation": "Instant",
+				"results": {"cocaine": "Positive", "methadone": "detected", "opiates": "Negative"}
+			},
+			"prescribingInformation": ["Methadone 30ml daily"],
+			"riskInformation": {
+				"lastSelfReportedDate": "2024-01-10",
+				"mentalHealthDomain": {"noIdentifiedRisk": "Yes", "psychosis": "No"},
+				"socialDomain": {"housingAtRisk": "Yes"},
+				"substanceMisuseDomain": {"injecting": "Y", "polyDrugUse": "yes"}
+			},
+			"safeguardingInformation": {"lastReviewDate": "2024-01-05", "riskToChildrenOrYP": "Yes", "riskToSelf": "No"}
+		},
+		"keyWorker": {"localIdentifier": 42, "name": {"family": "Worker", "given": "Kate"}, "telecom": "07700900123"}
+	}
+}`
+
+const cglNoClientResponse = `{"data": {"client": {}, "keyWorker": {"name": {}}}}`
+
+func TestCGLClient(t *testing.T) {
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if r.Header.Get("X-API-KEY") != "key" || r.Header.Get("X-API-SECRET") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "9999999468") {
+			fmt.Fprint(w, cglClientResponse)
+			return
+		}
+		fmt.Fprint(w, cglNoClientResponse)
+	}))
+	defer srv.Close()
+	newQuery := func(nhs string) PDQQuery {
+		return PDQQuery{Server_Mode: tukcnst.PDQ_SERVER_TYPE_CGL, Server_URL: srv.URL + "/client/", REG_OID: "2.16.840.1.113883.2.1.3.31.2.1.1",
+			CGL_X_Api_Key: "key", CGL_X_Api_Secret: "secret", NHS_ID: nhs, HTTPClient: http.DefaultClient}
+	}
+	i := newQuery("9999999468")
+	if err := New_Transaction(&i); err != nil {
+		t.Fatalf("New_Transaction() error = %v", err)
+	}
+	if path != "/client/9999999468" || i.Count != 1 || i.Patients == nil || len(*i.Patients) != 1 {
+		t.Fatalf("path = %s, Count = %v, want /client/9999999468 and 1 patient", path, i.Count)
+	}
+	pat := (*i.Patients)[0]
+	if pat.GivenName != "Fred John" || pat.FamilyName != "Bloggs" || pat.BirthDate != "19700102" || pat.Gender != "male" || pat.NHSID != "9999999468" ||
+		pat.Street != "1 Test Street" || pat.Town != "Headingley" || pat.Zip != "LS6 2BB" {
+		t.Errorf("patient = %+v", pat)
+	}
+	if len(pat.Names) != 1 || !reflect.DeepEqual(pat.Names[0].Given, []string{"Fred", "John"}) || len(pat.Addresses) != 1 || len(pat.Addresses[0].Line) != 2 {
+		t.Errorf("patient names = %+v, addresses = %+v", pat.Names, pat.Addresses)
+	}
+	if len(pat.Identifiers) != 2 || pat.Identifiers[1].Value != "123456" || pat.Identifiers[1].Authority.Name != CGL_LOCAL_IDENTIFIER {
+		t.Errorf("patient identifiers = %+v, want the cgl local identifier 123456", pat.Identifiers)
+	}
+	want := CGLSummary{
+		Key_Worker:        CGLKeyWorker{Local_ID: "42", Name: "Kate Worker", Telecom: "07700900123"},
+		Next_Appointment:  "2024-04-01",
+		Last_Engagement:   "2024-03-01",
+		Last_Face_To_Face: "2024-02-14",
+		BBV:               CGLBBV{Tested: true, HepC_Result: "Negative", HepC_Last_Test: "2023-11-01"},
+		Drug_Test:         CGLDrugTest{Date: "2024-02-14", Sample: "Urine", Status: "Complete", Type: "Instant", Positive: []string{"cocaine", "methadone"}},
+		Prescribing:       []string{"Methadone 30ml daily"},
+		Risks:             []string{"socialDomain.housingAtRisk", "substanceMisuseDomain.injecting", "substanceMisuseDomain.polyDrugUse"},
+		Risks_Reported:    "2024-01-10",
+		Safeguarding:      []string{"riskToChildrenOrYP"},
+		Safeguarding_Date: "2024-01-05",
+	}
+	if pat.CGLSummary == nil || !reflect.DeepEqual(*pat.CGLSummary, want) {
+		t.Errorf("patient CGLSummary = %+v, want %+v", pat.CGLSummary, want)
+	}
+	if got := i.CGLUserResponse.Summary(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Summary() = %+v, want %+v", got, want)
+	}
+
+	i = newQuery("9434765919")
+	if err := New_Transaction(&i); err != nil {
+		t.Fatalf("New_Transaction() error = %v", err)
+	}
+	if i.Count != 0 || (i.Patients != nil && len(*i.Patients) != 0) {
+		t.Errorf("Count = %v, Patients = %+v, want no patients for a response without a client", i.Count, i.Patients)
+	}
+	if got := i.CGLUserResponse.Summary(); !reflect.DeepEqual(got, CGLSummary{}) {
+		t.Errorf("Summary() = %+v, want an empty summary", got)
+	}
+}
@@ -0,0 +1,73 @@
+// Command tukpdq-gateway serves patient lookups as a REST API using tukpdq.Gateway.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ipthomas/tukpdq"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen `address`")
+	configFile := flag.String("config", os.Getenv(tukpdq.ENV_PDQ_CONFIG_FILE), "registry profile JSON `file`")
+	profile := flag.String("profile", os.Getenv(tukpdq.ENV_PDQ_PROFILE), "registry profile `name`, the file default profile if not set")
+	apiKey := flag.String("api-key", os.Getenv(tukpdq.ENV_PDQ_GATEWAY_API_KEY), "api `key` required in the X-API-KEY header of each request")
+	certFile := flag.String("tls-cert", "", "server tls certificate `file`, serves https if set")
+	keyFile := flag.String("tls-key", "", "server tls key `file`")
+	flag.Parse()
+	var q *tukpdq.PDQQuery
+	var err error
+	if *configFile != "" {
+		var config *tukpdq.PDQ_Config
+		if config, err = tukpdq.Load_PDQ_Config(*configFile); err == nil {
+			q, err = config.New_PDQQuery(*profile)
+		}
+	} else {
+		q, err = tukpdq.New_PDQQuery_From_Env()
+	}
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if q.HTTPClient == nil {
+		q.HTTPClient = &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}}
+	}
+	if *apiKey == "" {
+		log.Println("Warning - no api key is set, requests are not authenticated")
+	}
+	srv := http.Server{
+		Addr:              *addr,
+		Handler:           tukpdq.New_Gateway(tukpdq.Gateway_Config{Template: *q, API_Key: *apiKey}),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      time.Duration(q.Timeout+30) * time.Second,
+		IdleTimeout:       120 * time.Second,
+		MaxHeaderBytes:    16 * 1024,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdown); err != nil {
+			log.Println(err.Error())
+		}
+	}()
+	log.Printf("Serving %s %s patient lookups on %s", q.Server_Mode, q.Server_URL, *addr)
+	if *certFile != "" {
+		err = srv.ListenAndServeTLS(*certFile, *keyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err.Error())
+	}
+}
@@ -0,0 +1,215 @@
+// Command tukpdq runs an ad hoc PIX or PDQ lookup and prints the resolved patients.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ipthomas/tukcnst"
+	"github.com/ipthomas/tukpdq"
+)
+
+const (
+	FORMAT_TABLE = "table"
+	FORMAT_JSON  = "json"
+	FORMAT_FHIR  = "fhir"
+	FORMAT_HL7V2 = "hl7v2"
+)
+
+type idFlags []string
+
+func (f *idFlags) String() string {
+	return strings.Join(*f, ",")
+}
+func (f *idFlags) Set(v string) error {
+	if !strings.Contains(v, "|") {
+		return errors.New("identifier " + v + " is not in the form system|value")
+	}
+	*f = append(*f, v)
+	return nil
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "tukpdq: "+err.Error())
+		os.Exit(1)
+	}
+}
+func run(args []string, stdout io.Writer, stderr io.Writer) error {
+	var ids idFlags
+	fs := flag.NewFlagSet("tukpdq", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configFile := fs.String("config", os.Getenv(tukpdq.ENV_PDQ_CONFIG_FILE), "registry profile JSON `file`")
+	profile := fs.String("profile", os.Getenv(tukpdq.ENV_PDQ_PROFILE), "registry profile `name`, the file default profile if not set")
+	mode := fs.String("mode", "", "server mode, pixm, pixv3, pdqv3, pdqm, cgl, delphi or a registered provider mode")
+	url := fs.String("url", "", "server url")
+	regOID := fs.String("reg-oid", "", "regional (XDS affinity domain) oid")
+	nhsOID := fs.String("nhs-oid", "", "nhs number oid")
+	mrnOID := fs.String("mrn-oid", "", "mrn oid")
+	timeout := fs.Int("timeout", 0, "request timeout in `seconds`")
+	sender := fs.String("sender", "", "pixv3 and pdqv3 sender application `oid`, "+tukpdq.ENV_PDQ_SENDER_APP_OID+" if not set")
+	receiver := fs.String("receiver", "", "pixv3 and pdqv3 receiver application `oid`, "+tukpdq.ENV_PDQ_RECEIVER_APP_OID+" if not set")
+	cglKey := fs.String("cgl-key", "", "cgl api key, "+tukcnst.ENV_CGL_X_API_KEY+" if not set")
+	cglSecret := fs.String("cgl-secret", "", "cgl api secret, "+tukcnst.ENV_CGL_X_API_SECRET+" if not set")
+	delphiKey := fs.String("delphi-key", "", "delphi api key, "+tukpdq.ENV_DELPHI_X_API_KEY+" if not set")
+	delphiSecret := fs.String("delphi-secret", "", "delphi api secret, "+tukpdq.ENV_DELPHI_X_API_SECRET+" if not set")
+	nhs := fs.String("nhs", "", "nhs number to search on")
+	mrn := fs.String("mrn", "", "mrn to search on, requires -mrn-oid")
+	reg := fs.String("reg", "", "regional id to search on")
+	fs.Var(&ids, "id", "identifier to search on as `system|value`, the system is an oid, urn:oid: or registered FHIR system. May be repeated")
+	given := fs.String("given", "", "given name")
+	family := fs.String("family", "", "family name")
+	dob := fs.String("dob", "", "birth date, YYYYMMDD or YYYY-MM-DD")
+	gender := fs.String("gender", "", "gender")
+	postcode := fs.String("postcode", "", "postcode")
+	format := fs.String("format", FORMAT_TABLE, "output `format`, table, json, fhir or hl7v2")
+	verbose := fs.Bool("v", false, "log the http exchange and dump the raw request and response")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch *format {
+	case FORMAT_TABLE, FORMAT_JSON, FORMAT_FHIR, FORMAT_HL7V2:
+	default:
+		return errors.New("format " + *format + " is not supported")
+	}
+	log.SetOutput(io.Discard)
+	if *verbose {
+		log.SetOutput(stderr)
+	}
+	var q *tukpdq.PDQQuery
+	var err error
+	switch {
+	case *configFile != "":
+		var config *tukpdq.PDQ_Config
+		if config, err = tukpdq.Load_PDQ_Config(*configFile); err == nil {
+			q, err = config.New_PDQQuery(*profile)
+		}
+	case *mode != "":
+		for _, f := range []struct {
+			value *string
+			env   string
+		}{{sender, tukpdq.ENV_PDQ_SENDER_APP_OID}, {receiver, tukpdq.ENV_PDQ_RECEIVER_APP_OID}, {cglKey, tukcnst.ENV_CGL_X_API_KEY},
+			{cglSecret, tukcnst.ENV_CGL_X_API_SECRET}, {delphiKey, tukpdq.ENV_DELPHI_X_API_KEY}, {delphiSecret, tukpdq.ENV_DELPHI_X_API_SECRET}} {
+			if *f.value == "" {
+				*f.value = os.Getenv(f.env)
+			}
+		}
+		q, err = tukpdq.PDQ_Profile{Server_Mode: *mode, Server_URL: *url, REG_OID: *regOID, NHS_OID: *nhsOID, MRN_OID: *mrnOID, Timeout: *timeout,
+			Sender: tukpdq.HL7V3Device_Config{Application_OID: *sender}, Receiver: tukpdq.HL7V3Device_Config{Application_OID: *receiver},
+			CGL_X_Api_Key: *cglKey, CGL_X_Api_Secret: *cglSecret, Delphi_X_Api_Key: *delphiKey, Delphi_X_Api_Secret: *delphiSecret}.New_PDQQuery()
+	default:
+		q, err = tukpdq.New_PDQQuery_From_Env()
+	}
+	if err != nil {
+		return err
+	}
+	for _, o := range []struct{ value, field *string }{{mode, &q.Server_Mode}, {url, &q.Server_URL}, {regOID, &q.REG_OID}, {nhsOID, &q.NHS_OID}, {mrnOID, &q.MRN_OID},
+		{sender, &q.Sender.Application_OID}, {receiver, &q.Receiver.Application_OID}, {cglKey, &q.CGL_X_Api_Key}, {cglSecret, &q.CGL_X_Api_Secret},
+		{delphiKey, &q.Delphi_X_Api_Key}, {delphiSecret, &q.Delphi_X_Api_Secret}} {
+		if *o.value != "" {
+			*o.field = *o.value
+		}
+	}
+	if *timeout > 0 {
+		q.Timeout = *timeout
+	}
+	q.NHS_ID, q.MRN_ID, q.REG_ID = *nhs, *mrn, *reg
+	q.GivenName, q.FamilyName, q.BirthDate, q.Gender, q.Zip = *given, *family, *dob, *gender, *postcode
+	for _, id := range ids {
+		system, value, _ := strings.Cut(id, "|")
+		q.Identifiers = append(q.Identifiers, tukpdq.New_PatientID(system, value))
+	}
+	if err = checkSearch(q); err != nil {
+		fs.Usage()
+		return err
+	}
+	q.DebugMode = q.DebugMode || *verbose
+	if q.HTTPClient == nil {
+		q.HTTPClient = &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}}
+	}
+	err = tukpdq.New_Transaction(q)
+	if *verbose {
+		fmt.Fprintf(stderr, "Request:\n%s\n\nResponse (status %v):\n%s\n\n", q.Request, q.StatusCode, q.Response)
+	}
+	if err != nil {
+		return err
+	}
+	return writePatients(stdout, stderr, q, *format)
+}
+
+// checkSearch rejects id and demographic flag combinations the server mode cannot use before any request is sent
+func checkSearch(q *tukpdq.PDQQuery) error {
+	demographics := q.GivenName != "" || q.FamilyName != "" || q.BirthDate != "" || q.Gender != "" || q.Zip != ""
+	switch {
+	case q.MRN_ID != "" && q.MRN_OID == "":
+		return errors.New("invalid flags - -mrn requires -mrn-oid")
+	case (q.Server_Mode == tukcnst.PDQ_SERVER_TYPE_CGL || q.Server_Mode == tukpdq.PDQ_SERVER_TYPE_DELPHI) && q.NHS_ID == "":
+		return errors.New("invalid flags - " + q.Server_Mode + " mode requires -nhs")
+	case !q.Is_Demographic_Search():
+		return nil
+	case !demographics:
+		return errors.New("invalid flags - an id (-nhs, -mrn, -reg or -id) or demographics (-given, -family, -dob, -gender or -postcode) are required")
+	case q.Server_Mode != tukcnst.PDQ_SERVER_TYPE_IHE_PDQV3 && q.Server_Mode != tukpdq.PDQ_SERVER_TYPE_IHE_PDQM:
+		return errors.New("invalid flags - " + q.Server_Mode + " mode requires an id (-nhs, -mrn, -reg or -id), demographic searches require -mode pdqv3 or pdqm")
+	case q.GivenName == "" && q.FamilyName == "" && q.BirthDate == "":
+		return errors.New("invalid flags - " + q.Server_Mode + " demographic searches require -given, -family or -dob")
+	}
+	return nil
+}
+func writePatients(stdout io.Writer, stderr io.Writer, q *tukpdq.PDQQuery, format string) error {
+	var pats []tukpdq.TUKPatient
+	if q.Patients != nil {
+		pats = *q.Patients
+	}
+	for _, issue := range q.Issues {
+		fmt.Fprintln(stderr, "issue: "+issue)
+	}
+	switch format {
+	case FORMAT_JSON:
+		return writeJSON(stdout, pats)
+	case FORMAT_FHIR:
+		return writeJSON(stdout, q.FHIR_Bundle())
+	case FORMAT_HL7V2:
+		for n := range pats {
+			fmt.Fprintln(stdout, pats[n].PID_Segment())
+		}
+		return nil
+	}
+	if len(pats) == 0 {
+		fmt.Fprintln(stderr, "no patients found")
+		return nil
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NHS ID\tMRN\tREG ID\tNAME\tBIRTH DATE\tGENDER\tPOSTCODE\tSCORE\tSTATUS")
+	for n := range pats {
+		pat := pats[n]
+		score := ""
+		if pat.Match != nil {
+			score = fmt.Sprintf("%.0f %s", pat.Match.Score, pat.Match.Classification)
+		} else if pat.MatchScore > 0 {
+			score = fmt.Sprintf("%v", pat.MatchScore)
+		}
+		status := "active"
+		if pat.Inactive || pat.Is_Merged() {
+			status = "inactive"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", pat.NHSID, pat.PID, pat.REGID, strings.TrimSpace(pat.GivenName+" "+pat.FamilyName), pat.BirthDate, pat.Gender, pat.Zip, score, status)
+	}
+	return tw.Flush()
+}
+func writeJSON(w io.Writer, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRunRejectsUnusableFlags(t *testing.T) {
+	server := []string{"-url", "http://127.0.0.1:1/pdq", "-reg-oid", "2.16.840.1.113883.2.1.3.31.2.1.1"}
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"-mode", "pixm", "-family", "Bloggs"}, "demographic searches require -mode pdqv3"},
+		{[]string{"-mode", "pdqv3", "-gender", "male"}, "require -given, -family or -dob"},
+		{[]string{"-mode", "pixm"}, "an id (-nhs, -mrn, -reg or -id) or demographics"},
+		{[]string{"-mode", "pixm", "-mrn", "12345"}, "-mrn requires -mrn-oid"},
+		{[]string{"-mode", "cgl", "-cgl-key", "key", "-cgl-secret", "secret", "-reg", "R1"}, "cgl mode requires -nhs"},
+		{[]string{"-mode", "delphi", "-delphi-key", "key", "-delphi-secret", "secret", "-family", "Bloggs"}, "delphi mode requires -nhs"},
+	}
+	for _, tt := range tests {
+		err := run(append(tt.args, server...), io.Discard, io.Discard)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("run(%v) = %v, want %q", tt.args, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package tukpdq
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ipthomas/tukcnst"
+)
+
+const (
+	ENV_PDQ_CONFIG_FILE = "PDQ_CONFIG_FILE"
+	ENV_PDQ_PROFILE     = "PDQ_PROFILE"
+)
+
+// PDQ_Config holds the named registry profiles of a JSON config file
+type PDQ_Config struct {
+	Default     string                        `json:",omitempty"`
+	Profiles    map[string]PDQ_Profile        `json:",omitempty"`
+	Authorities map[string]AssigningAuthority `json:",omitempty"`
+}
+type PDQ_Profile struct {
+	Server_Mode         string             `json:",omitempty"`
+	Server_URL          string             `json:",omitempty"`
+	CGL_X_Api_Key       string             `json:",omitempty"`
+	CGL_X_Api_Secret    string             `json:",omitempty"`
+	Delphi_X_Api_Key    string             `json:",omitempty"`
+	Delphi_X_Api_Secret string             `json:",omitempty"`
+	NHS_OID             string             `json:",omitempty"`
+	MRN_OID             string             `json:",omitempty"`
+	REG_OID             string             `json:",omitempty"`
+	Timeout             int                `json:",omitempty"`
+	DebugMode           bool               `json:",omitempty"`
+	Sender              HL7V3Device_Config `json:",omitempty"`
+	Receiver            HL7V3Device_Config `json:",omitempty"`
+	Message_ID_Root     string             `json:",omitempty"`
+	TLS_Cert_File       string             `json:",omitempty"`
+	TLS_Key_File        string             `json:",omitempty"`
+	TLS_CA_File         string             `json:",omitempty"`
+	PIXm_System         string             `json:",omitempty"`
+	Delphi_Local_ID_OID string             `json:",omitempty"`
+}
+
+// UnmarshalJSON accepts Timeout and DebugMode as JSON numbers and booleans or as strings
+func (p *PDQ_Profile) UnmarshalJSON(b []byte) error {
+	type profile PDQ_Profile
+	aux := struct {
+		*profile
+		Timeout   any
+		DebugMode any
+	}{profile: (*profile)(p)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	switch v := aux.Timeout.(type) {
+	case float64:
+		p.Timeout = int(v)
+	case string:
+		var err error
+		if p.Timeout, err = strconv.Atoi(v); err != nil {
+			return errors.New("invalid configuration - timeout " + v + " is not a number")
+		}
+	}
+	switch v := aux.DebugMode.(type) {
+	case bool:
+		p.DebugMode = v
+	case string:
+		var err error
+		if p.DebugMode, err = strconv.ParseBool(v); err != nil {
+			return errors.New("invalid configuration - debugmode " + v + " is not a boolean value")
+		}
+	}
+	return nil
+}
+
+// Load_PDQ_Config reads a JSON registry profile file and expands any environment variable references. YAML files are rejected
+func Load_PDQ_Config(file string) (*PDQ_Config, error) {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return nil, errors.New("invalid configuration - " + file + " is a yaml file, registry profiles must be defined in json")
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]any
+	if err = json.Unmarshal(b, &tree); err != nil {
+		return nil, errors.New("invalid configuration - unable to parse " + file + " - " + err.Error())
+	}
+	var expanded any
+	if expanded, err = expandEnvValues(tree); err != nil {
+		return nil, err
+	}
+	if b, err = json.Marshal(expanded); err != nil {
+		return nil, err
+	}
+	config := PDQ_Config{}
+	if err = json.Unmarshal(b, &config); err != nil {
+		return nil, err
+	}
+	if len(config.Profiles) == 0 {
+		return nil, errors.New("invalid configuration - no profiles defined in " + file)
+	}
+	for name, aa := range config.Authorities {
+		if aa.Name == "" {
+			aa.Name = name
+		}
+		if err = Register_Authority(aa); err != nil {
+			return nil, err
+		}
+	}
+	return &config, nil
+}
+
+// Load_PDQ_Profile returns a PDQQuery for the PDQ_PROFILE profile of the PDQ_CONFIG_FILE config file
+func Load_PDQ_Profile() (*PDQQuery, error) {
+	file := os.Getenv(ENV_PDQ_CONFIG_FILE)
+	if file == "" {
+		return nil, errors.New("invalid configuration - " + ENV_PDQ_CONFIG_FILE + " is not set")
+	}
+	config, err := Load_PDQ_Config(file)
+	if err != nil {
+		return nil, err
+	}
+	return config.New_PDQQuery(os.Getenv(ENV_PDQ_PROFILE))
+}
+
+// New_PDQQuery returns a PDQQuery configured from the named profile. If name is empty the Default profile is used
+func (c *PDQ_Config) New_PDQQuery(name string) (*PDQQuery, error) {
+	if name == "" {
+		name = c.Default
+	}
+	if name == "" && len(c.Profiles) == 1 {
+		for n := range c.Profiles {
+			name = n
+		}
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return nil, errors.New("invalid configuration - profile " + name + " is not defined")
+	}
+	return p.New_PDQQuery()
+}
+
+// New_PDQQuery returns a PDQQuery configured from the profile
+func (p PDQ_Profile) New_PDQQuery() (*PDQQuery, error) {
+	var errs []string
+	switch p.Server_Mode {
+	case "":
+		errs = append(errs, "server mode is not set")
+	case tukcnst.PDQ_SERVER_TYPE_IHE_PIXM, tukcnst.PDQ_SERVER_TYPE_IHE_PIXV3, tukcnst.PDQ_SERVER_TYPE_IHE_PDQV3, PDQ_SERVER_TYPE_IHE_PDQM:
+	default:
+		if _, ok := Registered_Provider(p.Server_Mode); !ok {
+			errs = append(errs, "server mode "+p.Server_Mode+" is not supported")
+		}
+	}
+	if p.Server_URL == "" {
+		errs = append(errs, "server url is not set")
+	}
+	if p.REG_OID == "" {
+		errs = append(errs, "reg oid is not set")
+	}
+	if p.Server_Mode == tukcnst.PDQ_SERVER_TYPE_CGL && (p.CGL_X_Api_Key == "" || p.CGL_X_Api_Secret == "") {
+		errs = append(errs, "cgl api key and secret are required")
+	}
+	if p.Server_Mode == PDQ_SERVER_TYPE_DELPHI && (p.Delphi_X_Api_Key == "" || p.Delphi_X_Api_Secret == "") {
+		errs = append(errs, "delphi api key and secret are required")
+	}
+	if (p.TLS_Cert_File == "") != (p.TLS_Key_File == "") {
+		errs = append(errs, "tls cert file and tls key file must both be set")
+	}
+	if len(errs) > 0 {
+		return nil, errors.New("invalid configuration - " + strings.Join(errs, ", "))
+	}
+	i := PDQQuery{
+		Server_Mode:         p.Server_Mode,
+		Server_URL:          p.Server_URL,
+		CGL_X_Api_Key:       p.CGL_X_Api_Key,
+		CGL_X_Api_Secret:    p.CGL_X_Api_Secret,
+		Delphi_X_Api_Key:    p.Delphi_X_Api_Key,
+		Delphi_X_Api_Secret: p.Delphi_X_Api_Secret,
+		NHS_OID:             p.NHS_OID,
+		MRN_OID:             p.MRN_OID,
+		REG_OID:             p.REG_OID,
+		Timeout:             p.Timeout,
+		DebugMode:           p.DebugMode,
+		Sender:              p.Sender,
+		Receiver:            p.Receiver,
+		Message_ID_Root:     p.Message_ID_Root,
+		PIXm_System:         p.PIXm_System,
+		Delphi_Local_ID_OID: p.Delphi_Local_ID_OID,
+	}
+	if p.TLS_Cert_File != "" || p.TLS_CA_File != "" {
+		tlsConfig, err := p.newTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		i.HTTPClient = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment}}
+	}
+	return &i, nil
+}
+func (p PDQ_Profile) newTLSConfig() (*tls.Config, error) {
+	tlsConfig := tls.Config{MinVersion: tls.VersionTLS12}
+	if p.TLS_Cert_File != "" {
+		cert, err := tls.LoadX509KeyPair(p.TLS_Cert_File, p.TLS_Key_File)
+		if err != nil {
+			return nil, errors.New("invalid configuration - unable to load tls client certificate - " + err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if p.TLS_CA_File != "" {
+		ca, err := os.ReadFile(p.TLS_CA_File)
+		if err != nil {
+			return nil, errors.New("invalid configuration - unable to read tls ca file - " + err.Error())
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, errors.New("invalid configuration - no certificates found in tls ca file " + p.TLS_CA_File)
+		}
+	}
+	return &tlsConfig, nil
+}
+
+// expandEnvValues replaces ${VAR} and ${VAR:-default} references in string values
+func expandEnvValues(v any) (any, error) {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			exp, err := expandEnvValues(val)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = exp
+		}
+	case []any:
+		for k, val := range t {
+			exp, err := expandEnvValues(val)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = exp
+		}
+	case string:
+		return expandEnv(t)
+	}
+	return v, nil
+}
+func expandEnv(s string) (string, error) {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			return "", errors.New("invalid configuration - unterminated environment variable reference in " + s)
+		}
+		b.WriteString(s[:start])
+		ref := s[start+2 : start+end]
+		name, def, hasDef := strings.Cut(ref, ":-")
+		val, ok := os.LookupEnv(name)
+		switch {
+		case ok && val != "":
+			b.WriteString(val)
+		case hasDef:
+			b.WriteString(def)
+		case ok:
+		default:
+			return "", errors.New("invalid configuration - environment variable " + name + " is not set")
+		}
+		s = s[start+end+1:]
+	}
+}
@@ -0,0 +1,80 @@
+package tukpdq
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("TUKPDQ_TEST_DIR", "/certs")
+	t.Setenv("TUKPDQ_TEST_EMPTY", "")
+	os.Unsetenv("TUKPDQ_TEST_UNSET")
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: "no references", want: "no references"},
+		{in: "${TUKPDQ_TEST_DIR}/client.pem", want: "/certs/client.pem"},
+		{in: "${TUKPDQ_TEST_DIR}:${TUKPDQ_TEST_DIR}", want: "/certs:/certs"},
+		{in: "${TUKPDQ_TEST_UNSET:-5}", want: "5"},
+		{in: "${TUKPDQ_TEST_EMPTY:-5}", want: "5"},
+		{in: "${TUKPDQ_TEST_UNSET:-}", want: ""},
+		{in: "x${TUKPDQ_TEST_EMPTY}y", want: "xy"},
+		{in: "${TUKPDQ_TEST_UNSET}", err: true},
+		{in: "${TUKPDQ_TEST_DIR", err: true},
+	}
+	for _, tt := range tests {
+		got, err := expandEnv(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("expandEnv(%q) = %q, %v, want %q, error %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestLoadPDQConfig(t *testing.T) {
+	t.Setenv("TUKPDQ_TEST_TIMEOUT", "")
+	dir := t.TempDir()
+	file := filepath.Join(dir, "registries.json")
+	config := `{
+	"Default": "dev",
+	"Profiles": {
+		"dev": {
+			"Server_Mode": "pixv3",
+			"Server_URL": "https://pix.dev.example.nhs.uk/pixv3",
+			"REG_OID": "2.16.840.1.113883.2.1.3.31.2.1.1",
+			"Timeout": "${TUKPDQ_TEST_TIMEOUT:-7}",
+			"DebugMode": "true",
+			"Sender": {
+				"Application_OID": "2.16.840.1.113883.2.1.3.31.2.1.1.1.3",
+				"Application_Name": "ICB_XDS"
+			}
+		}
+	}
+}`
+	if err := os.WriteFile(file, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Load_PDQ_Config(file)
+	if err != nil {
+		t.Fatalf("Load_PDQ_Config() error = %v", err)
+	}
+	q, err := c.New_PDQQuery("")
+	if err != nil {
+		t.Fatalf("New_PDQQuery() error = %v", err)
+	}
+	if q.Server_Mode != "pixv3" || q.Server_URL != "https://pix.dev.example.nhs.uk/pixv3" || q.Timeout != 7 || !q.DebugMode || q.Sender.Application_Name != "ICB_XDS" {
+		t.Errorf("New_PDQQuery() = %+v", q)
+	}
+	for _, name := range []string{"registries.yaml", "registries.YML"} {
+		file = filepath.Join(dir, name)
+		if err = os.WriteFile(file, []byte("Default: dev\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = Load_PDQ_Config(file); err == nil || !strings.Contains(err.Error(), "must be defined in json") {
+			t.Errorf("Load_PDQ_Config(%s) error = %v, want a json only error", name, err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package tukpdq
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ipthomas/tukhttp"
+)
+
+const (
+	PDQ_SERVER_TYPE_DELPHI      = "delphi"
+	ENV_DELPHI_SERVER_URL       = "DELPHI_SERVER_URL"
+	ENV_DELPHI_X_API_KEY        = "DELPHI_X_API_KEY"
+	ENV_DELPHI_X_API_SECRET     = "DELPHI_X_API_SECRET"
+	ENV_DELPHI_LOCAL_ID_OID     = "DELPHI_LOCAL_ID_OID"
+	DELPHI_QUERY_PARAM_NHS_ID   = "NHSNumber"
+	DELPHI_QUERY_PARAM_LOCAL_ID = "LocalIdentifier"
+	DELPHI_LOCAL_IDENTIFIER     = "Delphi Local Identifier"
+)
+
+// delphiURL returns the Delphi API client url for the query NHS id, or the Delphi local identifier if no NHS id is set
+func (i *PDQQuery) delphiURL() string {
+	if i.NHS_ID != "" {
+		return i.Server_URL + "?" + DELPHI_QUERY_PARAM_NHS_ID + "=" + url.QueryEscape(i.NHS_ID)
+	}
+	return i.Server_URL + "?" + DELPHI_QUERY_PARAM_LOCAL_ID + "=" + url.QueryEscape(i.Delphi_Local_ID)
+}
+
+// delphiProvider queries the Delphi API for the client with the query NHS id or Delphi local identifier
+type delphiProvider struct{}
+
+func (delphiProvider) New_Request(i *PDQQuery) (*tukhttp.HTTPRequest, error) {
+	return &tukhttp.HTTPRequest{
+		Method:       http.MethodGet,
+		URL:          i.delphiURL(),
+		X_Api_Key:    i.Delphi_X_Api_Key,
+		X_Api_Secret: i.Delphi_X_Api_Secret,
+		Timeout:      i.Timeout,
+		DebugMode:    i.DebugMode,
+	}, nil
+}
+func (delphiProvider) Send(i *PDQQuery, httpReq *tukhttp.HTTPRequest) error {
+	return i.newHTTPRequest(httpReq)
+}
+func (delphiProvider) Map_Patients(i *PDQQuery, rsp []byte) ([]TUKPatient, error) {
+	if err := json.Unmarshal(rsp, &i.DelphiResponse); err != nil {
+		return nil, err
+	}
+	if i.DelphiResponse.Data.LocalIdentifier == 0 && i.DelphiResponse.Data.Surname == "" {
+		return nil, nil
+	}
+	return []TUKPatient{i.newDelphiPatient()}, nil
+}
+
+// delphiAuthority returns the assigning authority of the Delphi local identifier domain
+func (i *PDQQuery) delphiAuthority() AssigningAuthority {
+	if i.Delphi_Local_ID_OID == "" {
+		return AssigningAuthority{Name: DELPHI_LOCAL_IDENTIFIER}
+	}
+	aa := Authority_From_OID(i.Delphi_Local_ID_OID)
+	if aa.Name == "" {
+		aa.Name = DELPHI_LOCAL_IDENTIFIER
+	}
+	return aa
+}
+
+// newDelphiPatient returns the Delphi client details as a TUKPatient with the query NHS id
+func (i *PDQQuery) newDelphiPatient() TUKPatient {
+	client := i.DelphiResponse.Data
+	pat := TUKPatient{
+		Gender:    strings.ToLower(client.GenderAtBirth),
+		BirthDate: strings.ReplaceAll(strings.Split(client.DateOfBirth, "T")[0], "-", ""),
+		Status:    client.Status,
+	}
+	if i.NHS_ID != "" {
+		pat.addID(i, PatientID{Value: i.NHS_ID, Authority: Authority_From_OID(i.NHS_OID)})
+	}
+	if client.LocalIdentifier != 0 {
+		pat.addID(i, PatientID{Value: strconv.Itoa(client.LocalIdentifier), Authority: i.delphiAuthority()})
+	}
+	name := HumanName{Given: strings.Fields(client.Forename), Family: client.Surname}
+	if client.Title != "" {
+		name.Prefix = []string{client.Title}
+	}
+	pat.Names = []HumanName{name}
+	addr := Address{PostalCode: strings.TrimSpace(client.Address.PostCode1 + " " + client.Address.PostCode2)}
+	for _, line := range []string{client.Address.AddressLine1, client.Address.AddressLine2, client.Address.AddressLine3, client.Address.AddressLine4} {
+		if strings.TrimSpace(line) != "" {
+			addr.Line = append(addr.Line, line)
+		}
+	}
+	if len(addr.Line) > 0 || addr.PostalCode != "" {
+		pat.Addresses = []Address{addr}
+	}
+	pat.setFlatFields()
+	return pat
+}
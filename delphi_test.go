@@ -0,0 +1,43 @@
+package tukpdq
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDelphiLocalID(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get(DELPHI_QUERY_PARAM_LOCAL_ID) != "1234" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"Data":{"LocalIdentifier":1234,"Forename":"Fred","Surname":"Bloggs","GenderAtBirth":"Male"}}`)
+	}))
+	defer srv.Close()
+	newQuery := func(oid string) PDQQuery {
+		return PDQQuery{Server_Mode: PDQ_SERVER_TYPE_DELPHI, Server_URL: srv.URL, REG_OID: "2.16.840.1.113883.2.1.3.31.2.1.1", Delphi_X_Api_Key: "key",
+			Delphi_X_Api_Secret: "secret", Delphi_Local_ID: "1234", Delphi_Local_ID_OID: oid, HTTPClient: http.DefaultClient}
+	}
+	i := newQuery("")
+	if err := New_Transaction(&i); err == nil {
+		t.Error("New_Transaction() = nil, want delphi local id oid error")
+	}
+	i = newQuery("delphi")
+	if err := New_Transaction(&i); err == nil {
+		t.Error("New_Transaction() = nil, want invalid oid error")
+	}
+	oid := "2.16.840.1.113883.2.1.3.31.2.1.9"
+	i = newQuery(oid)
+	if err := New_Transaction(&i); err != nil {
+		t.Fatalf("New_Transaction() error = %v", err)
+	}
+	if i.Used_PID_OID != oid || i.Count != 1 {
+		t.Fatalf("Used_PID_OID = %q, Count = %v, want %q and 1", i.Used_PID_OID, i.Count, oid)
+	}
+	pat := (*i.Patients)[0]
+	if pat.Get_ID(oid) != "1234" || pat.idIn(i.Used_PID_OID) != i.Used_PID {
+		t.Errorf("patient identifiers = %+v, want 1234 in %s", pat.Identifiers, oid)
+	}
+}
@@ -0,0 +1,132 @@
+package tukpdq
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ipthomas/tukcnst"
+)
+
+const (
+	ENV_PDQ_TIMEOUT                = "PDQ_TIMEOUT"
+	ENV_PDQ_SENDER_APP_OID         = "PDQ_SENDER_APP_OID"
+	ENV_PDQ_SENDER_APP_NAME        = "PDQ_SENDER_APP_NAME"
+	ENV_PDQ_SENDER_FACILITY_OID    = "PDQ_SENDER_FACILITY_OID"
+	ENV_PDQ_SENDER_FACILITY_NAME   = "PDQ_SENDER_FACILITY_NAME"
+	ENV_PDQ_RECEIVER_APP_OID       = "PDQ_RECEIVER_APP_OID"
+	ENV_PDQ_RECEIVER_APP_NAME      = "PDQ_RECEIVER_APP_NAME"
+	ENV_PDQ_RECEIVER_FACILITY_OID  = "PDQ_RECEIVER_FACILITY_OID"
+	ENV_PDQ_RECEIVER_FACILITY_NAME = "PDQ_RECEIVER_FACILITY_NAME"
+	ENV_PDQ_MESSAGE_ID_ROOT        = "PDQ_MESSAGE_ID_ROOT"
+	ENV_PDQ_PIXM_SYSTEM            = "PDQ_PIXM_SYSTEM"
+)
+
+// New_PDQQuery_From_Env returns a PDQQuery configured from the PDQ_ and server type environment variables
+func New_PDQQuery_From_Env() (*PDQQuery, error) {
+	var errs []string
+	i := PDQQuery{
+		Server_Mode:         strings.ToLower(os.Getenv(tukcnst.ENV_PDQ_SERVER_TYPE)),
+		NHS_OID:             os.Getenv(tukcnst.ENV_NHS_OID),
+		REG_OID:             os.Getenv(tukcnst.ENV_REG_OID),
+		CGL_X_Api_Key:       os.Getenv(tukcnst.ENV_CGL_X_API_KEY),
+		CGL_X_Api_Secret:    os.Getenv(tukcnst.ENV_CGL_X_API_SECRET),
+		Delphi_X_Api_Key:    os.Getenv(ENV_DELPHI_X_API_KEY),
+		Delphi_X_Api_Secret: os.Getenv(ENV_DELPHI_X_API_SECRET),
+		Message_ID_Root:     os.Getenv(ENV_PDQ_MESSAGE_ID_ROOT),
+		PIXm_System:         os.Getenv(ENV_PDQ_PIXM_SYSTEM),
+		Delphi_Local_ID_OID: os.Getenv(ENV_DELPHI_LOCAL_ID_OID),
+		Sender: HL7V3Device_Config{
+			Application_OID:  os.Getenv(ENV_PDQ_SENDER_APP_OID),
+			Application_Name: os.Getenv(ENV_PDQ_SENDER_APP_NAME),
+			Facility_OID:     os.Getenv(ENV_PDQ_SENDER_FACILITY_OID),
+			Facility_Name:    os.Getenv(ENV_PDQ_SENDER_FACILITY_NAME),
+		},
+		Receiver: HL7V3Device_Config{
+			Application_OID:  os.Getenv(ENV_PDQ_RECEIVER_APP_OID),
+			Application_Name: os.Getenv(ENV_PDQ_RECEIVER_APP_NAME),
+			Facility_OID:     os.Getenv(ENV_PDQ_RECEIVER_FACILITY_OID),
+			Facility_Name:    os.Getenv(ENV_PDQ_RECEIVER_FACILITY_NAME),
+		},
+	}
+	modeURLEnv := ""
+	switch i.Server_Mode {
+	case "":
+		errs = append(errs, tukcnst.ENV_PDQ_SERVER_TYPE+" is not set")
+	case tukcnst.PDQ_SERVER_TYPE_IHE_PIXM:
+		modeURLEnv = tukcnst.ENV_IHE_PIXM_SERVER_URL
+	case tukcnst.PDQ_SERVER_TYPE_IHE_PIXV3:
+		modeURLEnv = tukcnst.ENV_IHE_PIXV3_SERVER_URL
+	case tukcnst.PDQ_SERVER_TYPE_IHE_PDQV3:
+		modeURLEnv = tukcnst.ENV_IHE_PDQV3_SERVER_URL
+	case PDQ_SERVER_TYPE_IHE_PDQM:
+		modeURLEnv = ENV_IHE_PDQM_SERVER_URL
+	case tukcnst.PDQ_SERVER_TYPE_CGL:
+		modeURLEnv = tukcnst.ENV_CGL_SERVER_URL
+	case PDQ_SERVER_TYPE_DELPHI:
+		modeURLEnv = ENV_DELPHI_SERVER_URL
+	default:
+		if _, ok := Registered_Provider(i.Server_Mode); !ok {
+			errs = append(errs, tukcnst.ENV_PDQ_SERVER_TYPE+" "+i.Server_Mode+" is not a supported server type")
+		} else if i.Server_URL = os.Getenv(tukcnst.ENV_PDQ_SERVER_URL); i.Server_URL == "" {
+			errs = append(errs, tukcnst.ENV_PDQ_SERVER_URL+" is not set")
+		}
+	}
+	if modeURLEnv != "" {
+		url := os.Getenv(tukcnst.ENV_PDQ_SERVER_URL)
+		modeURL := os.Getenv(modeURLEnv)
+		switch {
+		case url != "" && modeURL != "" && url != modeURL:
+			errs = append(errs, tukcnst.ENV_PDQ_SERVER_URL+" and "+modeURLEnv+" are both set with different values")
+		case url != "":
+			i.Server_URL = url
+		case modeURL != "":
+			i.Server_URL = modeURL
+		default:
+			errs = append(errs, "neither "+tukcnst.ENV_PDQ_SERVER_URL+" nor "+modeURLEnv+" is set")
+		}
+	}
+	if i.REG_OID == "" {
+		errs = append(errs, tukcnst.ENV_REG_OID+" is not set")
+	}
+	if i.NHS_OID == "" {
+		i.NHS_OID = tukcnst.NHS_OID_DEFAULT
+	}
+	switch i.Server_Mode {
+	case tukcnst.PDQ_SERVER_TYPE_CGL:
+		if i.CGL_X_Api_Key == "" {
+			errs = append(errs, tukcnst.ENV_CGL_X_API_KEY+" is not set")
+		}
+		if i.CGL_X_Api_Secret == "" {
+			errs = append(errs, tukcnst.ENV_CGL_X_API_SECRET+" is not set")
+		}
+	case PDQ_SERVER_TYPE_DELPHI:
+		if i.Delphi_X_Api_Key == "" {
+			errs = append(errs, ENV_DELPHI_X_API_KEY+" is not set")
+		}
+		if i.Delphi_X_Api_Secret == "" {
+			errs = append(errs, ENV_DELPHI_X_API_SECRET+" is not set")
+		}
+	case tukcnst.PDQ_SERVER_TYPE_IHE_PIXV3, tukcnst.PDQ_SERVER_TYPE_IHE_PDQV3:
+		if i.Sender.Application_OID == "" && Default_Sender.Application_OID == "" {
+			errs = append(errs, ENV_PDQ_SENDER_APP_OID+" is not set")
+		}
+	}
+	if debug := os.Getenv(tukcnst.ENV_DEBUG_MODE); debug != "" {
+		var err error
+		if i.DebugMode, err = strconv.ParseBool(debug); err != nil {
+			errs = append(errs, tukcnst.ENV_DEBUG_MODE+" "+debug+" is not a boolean value")
+		}
+	}
+	if timeout := os.Getenv(ENV_PDQ_TIMEOUT); timeout != "" {
+		var err error
+		if i.Timeout, err = strconv.Atoi(timeout); err != nil || i.Timeout < 1 {
+			errs = append(errs, ENV_PDQ_TIMEOUT+" "+timeout+" is not a positive number of seconds")
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.New("invalid configuration - " + strings.Join(errs, ", "))
+	}
+	return &i, nil
+}
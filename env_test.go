@@ -0,0 +1,80 @@
+package tukpdq
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipthomas/tukcnst"
+)
+
+func setTestEnv(t *testing.T, env map[string]string) {
+	for _, name := range []string{tukcnst.ENV_PDQ_SERVER_TYPE, tukcnst.ENV_PDQ_SERVER_URL, tukcnst.ENV_IHE_PIXM_SERVER_URL, tukcnst.ENV_IHE_PIXV3_SERVER_URL,
+		tukcnst.ENV_IHE_PDQV3_SERVER_URL, ENV_IHE_PDQM_SERVER_URL, tukcnst.ENV_CGL_SERVER_URL, tukcnst.ENV_REG_OID, tukcnst.ENV_NHS_OID, tukcnst.ENV_CGL_X_API_KEY,
+		tukcnst.ENV_CGL_X_API_SECRET, tukcnst.ENV_DEBUG_MODE, ENV_PDQ_TIMEOUT, ENV_PDQ_SENDER_APP_OID} {
+		t.Setenv(name, env[name])
+	}
+}
+
+func TestNewPDQQueryFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		errs []string
+	}{
+		{
+			name: "nothing set",
+			env:  map[string]string{},
+			errs: []string{"PDQ_SERVER_TYPE is not set", "REG_OID is not set"},
+		},
+		{
+			name: "pixv3 missing url and sender",
+			env:  map[string]string{tukcnst.ENV_PDQ_SERVER_TYPE: "pixv3", tukcnst.ENV_REG_OID: "2.16.840.1.113883.2.1.3.31.2.1.1"},
+			errs: []string{"neither PDQ_SERVER_URL nor IHE_PIXV3_SERVER_URL is set", "PDQ_SENDER_APP_OID is not set"},
+		},
+		{
+			name: "conflicting urls",
+			env: map[string]string{tukcnst.ENV_PDQ_SERVER_TYPE: "pixm", tukcnst.ENV_REG_OID: "2.16.840.1.113883.2.1.3.31.2.1.1",
+				tukcnst.ENV_PDQ_SERVER_URL: "https://pix.example.nhs.uk/a", tukcnst.ENV_IHE_PIXM_SERVER_URL: "https://pix.example.nhs.uk/b"},
+			errs: []string{"PDQ_SERVER_URL and IHE_PIXM_SERVER_URL are both set with different values"},
+		},
+		{
+			name: "bad debug mode and timeout",
+			env: map[string]string{tukcnst.ENV_PDQ_SERVER_TYPE: "pixm", tukcnst.ENV_REG_OID: "2.16.840.1.113883.2.1.3.31.2.1.1",
+				tukcnst.ENV_IHE_PIXM_SERVER_URL: "https://pix.example.nhs.uk/a", tukcnst.ENV_DEBUG_MODE: "yes please", ENV_PDQ_TIMEOUT: "0"},
+			errs: []string{"DEBUG_MODE yes please is not a boolean value", "PDQ_TIMEOUT 0 is not a positive number of seconds"},
+		},
+		{
+			name: "unsupported server type",
+			env:  map[string]string{tukcnst.ENV_PDQ_SERVER_TYPE: "xds", tukcnst.ENV_REG_OID: "2.16.840.1.113883.2.1.3.31.2.1.1"},
+			errs: []string{"PDQ_SERVER_TYPE xds is not a supported server type"},
+		},
+		{
+			name: "valid pixm",
+			env: map[string]string{tukcnst.ENV_PDQ_SERVER_TYPE: "PIXm", tukcnst.ENV_REG_OID: "2.16.840.1.113883.2.1.3.31.2.1.1",
+				tukcnst.ENV_PDQ_SERVER_URL: "https://pix.example.nhs.uk/a", tukcnst.ENV_IHE_PIXM_SERVER_URL: "https://pix.example.nhs.uk/a", tukcnst.ENV_DEBUG_MODE: "true"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestEnv(t, tt.env)
+			q, err := New_PDQQuery_From_Env()
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Fatalf("New_PDQQuery_From_Env() error = %v", err)
+				}
+				if q.Server_Mode != "pixm" || q.Server_URL != "https://pix.example.nhs.uk/a" || !q.DebugMode || q.NHS_OID != tukcnst.NHS_OID_DEFAULT {
+					t.Errorf("New_PDQQuery_From_Env() = %+v", q)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), "invalid configuration - ") {
+				t.Fatalf("New_PDQQuery_From_Env() error = %v, want an invalid configuration error", err)
+			}
+			for _, want := range tt.errs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("New_PDQQuery_From_Env() error = %v, want it to include %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package tukpdq
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ipthomas/tukcnst"
+)
+
+const (
+	FHIR_BUNDLE_TYPE_SEARCHSET = "searchset"
+	FHIR_MARITAL_STATUS_SYSTEM = "http://terminology.hl7.org/CodeSystem/v3-MaritalStatus"
+)
+
+// FHIRPatient is a FHIR R4 Patient resource
+type FHIRPatient struct {
+	ResourceType         string               `json:"resourceType"`
+	ID                   string               `json:"id,omitempty"`
+	Meta                 *FHIRMeta            `json:"meta,omitempty"`
+	Identifier           []FHIRIdentifier     `json:"identifier,omitempty"`
+	Active               *bool                `json:"active,omitempty"`
+	Name                 []HumanName          `json:"name,omitempty"`
+	Telecom              []Telecom            `json:"telecom,omitempty"`
+	Gender               string               `json:"gender,omitempty"`
+	BirthDate            string               `json:"birthDate,omitempty"`
+	DeceasedBoolean      *bool                `json:"deceasedBoolean,omitempty"`
+	Address              []Address            `json:"address,omitempty"`
+	MaritalStatus        *FHIRCodeableConcept `json:"maritalStatus,omitempty"`
+	MultipleBirthBoolean *bool                `json:"multipleBirthBoolean,omitempty"`
+	Link                 []FHIRPatientLink    `json:"link,omitempty"`
+}
+type FHIRMeta struct {
+	Source      string `json:"source,omitempty"`
+	LastUpdated string `json:"lastUpdated,omitempty"`
+}
+type FHIRIdentifier struct {
+	Use    string `json:"use,omitempty"`
+	System string `json:"system,omitempty"`
+	Value  string `json:"value"`
+}
+type FHIRCodeableConcept struct {
+	Coding []FHIRCoding `json:"coding,omitempty"`
+}
+type FHIRCoding struct {
+	System string `json:"system,omitempty"`
+	Code   string `json:"code,omitempty"`
+}
+type FHIRPatientLink struct {
+	Other struct {
+		Reference string `json:"reference"`
+	} `json:"other"`
+	Type string `json:"type"`
+}
+
+// FHIRBundle is a FHIR R4 searchset Bundle of Patient resources
+type FHIRBundle struct {
+	ResourceType string            `json:"resourceType"`
+	Type         string            `json:"type"`
+	Total        int               `json:"total"`
+	Entry        []FHIRBundleEntry `json:"entry,omitempty"`
+}
+type FHIRBundleEntry struct {
+	FullUrl  string      `json:"fullUrl,omitempty"`
+	Resource FHIRPatient `json:"resource"`
+}
+
+// FHIR_Patient returns the patient as a FHIR R4 Patient resource
+func (p *TUKPatient) FHIR_Patient() FHIRPatient {
+	active := !p.Inactive
+	pat := FHIRPatient{
+		ResourceType: FHIR_RESOURCE_PATIENT,
+		ID:           strings.TrimPrefix(p.Reference, FHIR_RESOURCE_PATIENT+"/"),
+		Active:       &active,
+		Name:         p.Names,
+		Telecom:      p.Telecom,
+		Gender:       fhirGender(p.Gender),
+		BirthDate:    fhirDate(p.BirthDate),
+		Address:      p.Addresses,
+	}
+	if meta := (FHIRMeta{Source: p.Source, LastUpdated: fhirInstant(p.LastUpdated)}); meta != (FHIRMeta{}) {
+		pat.Meta = &meta
+	}
+	for _, id := range []PatientID{
+		{Value: p.NHSID, Use: "official", Authority: Authority_From_OID(p.NHSOID)},
+		{Value: p.PID, Use: "usual", Authority: p.pidID().Authority},
+		{Value: p.REGID, Authority: Authority_From_OID(p.REGOID)},
+	} {
+		pat.addIdentifier(id)
+	}
+	for _, id := range p.Identifiers {
+		pat.addIdentifier(id)
+	}
+	if len(pat.Name) == 0 && (p.GivenName != "" || p.FamilyName != "") {
+		pat.Name = []HumanName{{Use: "usual", Given: strings.Fields(p.GivenName), Family: p.FamilyName}}
+	}
+	if len(pat.Address) == 0 && countSet(p.Street, p.Town, p.City, p.State, p.Zip, p.Country) > 0 {
+		addr := Address{Use: "home", City: p.City, State: p.State, PostalCode: p.Zip, Country: p.Country}
+		for _, line := range []string{p.Street, p.Town} {
+			if line != "" {
+				addr.Line = append(addr.Line, line)
+			}
+		}
+		pat.Address = []Address{addr}
+	}
+	if p.Deceased {
+		pat.DeceasedBoolean = &p.Deceased
+	}
+	if p.MultipleBirth {
+		pat.MultipleBirthBoolean = &p.MultipleBirth
+	}
+	if p.MaritalStatus != "" {
+		pat.MaritalStatus = &FHIRCodeableConcept{Coding: []FHIRCoding{{System: FHIR_MARITAL_STATUS_SYSTEM, Code: p.MaritalStatus}}}
+	}
+	for _, ref := range p.ReplacedBy {
+		pat.addLink(FHIR_LINK_REPLACED_BY, ref)
+	}
+	for _, ref := range p.Replaces {
+		pat.addLink(FHIR_LINK_REPLACES, ref)
+	}
+	return pat
+}
+
+// addIdentifier adds the identifier to the resource if it is not already present
+func (pat *FHIRPatient) addIdentifier(id PatientID) {
+	system := id.Authority.System()
+	if id.Value == "" || system == "" {
+		return
+	}
+	for n, fid := range pat.Identifier {
+		if fid.System == system && fid.Value == id.Value {
+			if fid.Use == "" {
+				pat.Identifier[n].Use = id.Use
+			}
+			return
+		}
+	}
+	pat.Identifier = append(pat.Identifier, FHIRIdentifier{Use: id.Use, System: system, Value: id.Value})
+}
+func (pat *FHIRPatient) addLink(linkType string, ref string) {
+	link := FHIRPatientLink{Type: linkType}
+	link.Other.Reference = ref
+	pat.Link = append(pat.Link, link)
+}
+
+// FHIR_Patients returns the query patients as FHIR R4 Patient resources
+func (i *PDQQuery) FHIR_Patients() []FHIRPatient {
+	pats := []FHIRPatient{}
+	if i.Patients == nil {
+		return pats
+	}
+	for n := range *i.Patients {
+		pats = append(pats, (*i.Patients)[n].FHIR_Patient())
+	}
+	return pats
+}
+
+// FHIR_Bundle returns the query patients as a FHIR R4 searchset Bundle
+func (i *PDQQuery) FHIR_Bundle() FHIRBundle {
+	bundle := FHIRBundle{ResourceType: "Bundle", Type: FHIR_BUNDLE_TYPE_SEARCHSET}
+	for n, pat := range i.FHIR_Patients() {
+		entry := FHIRBundleEntry{Resource: pat}
+		if ref := (*i.Patients)[n].Reference; ref != "" && (i.Server_Mode == tukcnst.PDQ_SERVER_TYPE_IHE_PIXM || i.Server_Mode == PDQ_SERVER_TYPE_IHE_PDQM) {
+			entry.FullUrl = i.resolveReference(ref)
+		}
+		bundle.Entry = append(bundle.Entry, entry)
+	}
+	bundle.Total = len(bundle.Entry)
+	return bundle
+}
+
+// Set_FHIR_Patient sets the query identifiers and demographics from a FHIR R4 Patient resource
+func (i *PDQQuery) Set_FHIR_Patient(pat FHIRPatient) error {
+	if pat.ResourceType != "" && pat.ResourceType != FHIR_RESOURCE_PATIENT {
+		return errors.New("invalid request - expected a Patient resource, received " + pat.ResourceType)
+	}
+	nhsOID := i.NHS_OID
+	if nhsOID == "" {
+		nhsOID = tukcnst.NHS_OID_DEFAULT
+	}
+	for _, fid := range pat.Identifier {
+		aa, _ := Authority_From_System(fid.System)
+		switch {
+		case fid.Value == "":
+		case aa.OID == nhsOID:
+			i.NHS_ID = fid.Value
+		case aa.OID != "" && aa.OID == i.REG_OID:
+			i.REG_ID = fid.Value
+		case aa.OID != "" && aa.OID == i.MRN_OID:
+			i.MRN_ID = fid.Value
+		default:
+			i.Identifiers = append(i.Identifiers, PatientID{Value: fid.Value, Use: fid.Use, Authority: aa})
+		}
+	}
+	tp := TUKPatient{Names: pat.Name, Addresses: pat.Address}
+	tp.setFlatFields()
+	i.GivenName = tp.GivenName
+	i.FamilyName = tp.FamilyName
+	i.Street = tp.Street
+	i.Town = tp.Town
+	i.City = tp.City
+	i.Zip = tp.Zip
+	i.Country = tp.Country
+	i.Gender = pat.Gender
+	i.BirthDate = strings.ReplaceAll(pat.BirthDate, "-", "")
+	return nil
+}
+
+// fhirGender returns the FHIR administrative gender for a FHIR or HL7 v3 gender code
+func fhirGender(gender string) string {
+	if g := normalisedGender(gender); g != "" {
+		return g
+	}
+	if gender == "" {
+		return ""
+	}
+	return "unknown"
+}
+
+// fhirInstant returns the dateTime if it is a valid FHIR instant, with seconds and a time zone, otherwise ""
+func fhirInstant(dt string) string {
+	if _, err := time.Parse(time.RFC3339Nano, dt); err != nil {
+		return ""
+	}
+	return dt
+}
+
+// fhirDate returns the FHIR date for a YYYYMMDD, YYYYMM or YYYY date. Dates already in FHIR format are returned unchanged
+func fhirDate(date string) string {
+	if strings.Contains(date, "-") {
+		return date
+	}
+	switch len(date) {
+	case 8:
+		return date[:4] + "-" + date[4:6] + "-" + date[6:]
+	case 6:
+		return date[:4] + "-" + date[4:]
+	}
+	return date
+}
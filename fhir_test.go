@@ -0,0 +1,140 @@
+package tukpdq
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ipthomas/tukcnst"
+)
+
+func TestFHIRPatient(t *testing.T) {
+	p := TUKPatient{
+		Reference:     "Patient/123",
+		Source:        "https://pix.example.nhs.uk/fhir",
+		LastUpdated:   "2024-01-02T10:00:00+01:00",
+		NHSOID:        tukcnst.NHS_OID_DEFAULT,
+		NHSID:         "9999999468",
+		PIDOID:        "2.16.840.1.113883.2.1.3.31.2.1.1.1.3.1.1",
+		PID:           "M123",
+		Identifiers:   []PatientID{{Value: "9999999468", Authority: Authority_From_OID(tukcnst.NHS_OID_DEFAULT)}, {Value: "L1", Authority: AssigningAuthority{OID: "1.2.3"}}},
+		GivenName:     "Fred John",
+		FamilyName:    "Bloggs",
+		Street:        "1 Test Street",
+		Zip:           "LS1 4AP",
+		Gender:        "M",
+		BirthDate:     "19700102",
+		MaritalStatus: "M",
+		Deceased:      true,
+		ReplacedBy:    []string{"Patient/456"},
+	}
+	pat := p.FHIR_Patient()
+	if pat.ResourceType != FHIR_RESOURCE_PATIENT || pat.ID != "123" || pat.Gender != "male" || pat.BirthDate != "1970-01-02" || pat.Active == nil || !*pat.Active ||
+		pat.DeceasedBoolean == nil || pat.MultipleBirthBoolean != nil || pat.MaritalStatus == nil || pat.MaritalStatus.Coding[0].Code != "M" {
+		t.Errorf("FHIR_Patient() = %+v", pat)
+	}
+	wantIDs := []FHIRIdentifier{
+		{Use: "official", System: "https://fhir.nhs.uk/Id/nhs-number", Value: "9999999468"},
+		{Use: "usual", System: "urn:oid:2.16.840.1.113883.2.1.3.31.2.1.1.1.3.1.1", Value: "M123"},
+		{System: "urn:oid:1.2.3", Value: "L1"},
+	}
+	if !reflect.DeepEqual(pat.Identifier, wantIDs) {
+		t.Errorf("FHIR_Patient() identifiers = %+v, want %+v", pat.Identifier, wantIDs)
+	}
+	if len(pat.Name) != 1 || pat.Name[0].Family != "Bloggs" || !reflect.DeepEqual(pat.Name[0].Given, []string{"Fred", "John"}) ||
+		len(pat.Address) != 1 || pat.Address[0].PostalCode != "LS1 4AP" || !reflect.DeepEqual(pat.Address[0].Line, []string{"1 Test Street"}) {
+		t.Errorf("FHIR_Patient() names = %+v, addresses = %+v, want the flat name and address", pat.Name, pat.Address)
+	}
+	if len(pat.Link) != 1 || pat.Link[0].Type != FHIR_LINK_REPLACED_BY || pat.Link[0].Other.Reference != "Patient/456" {
+		t.Errorf("FHIR_Patient() links = %+v", pat.Link)
+	}
+	if pat.Meta == nil || *pat.Meta != (FHIRMeta{Source: p.Source, LastUpdated: p.LastUpdated}) {
+		t.Errorf("FHIR_Patient() meta = %+v", pat.Meta)
+	}
+}
+
+func TestFHIRPatientMeta(t *testing.T) {
+	tests := []struct {
+		source, lastUpdated string
+		want                *FHIRMeta
+	}{
+		{"", "", nil},
+		{"", "2024-01-02T10:00:00", nil},
+		{"", "2024-01-02", nil},
+		{"https://pix.example.nhs.uk", "2024-01-02T10:00:00", &FHIRMeta{Source: "https://pix.example.nhs.uk"}},
+		{"", "2024-01-02T10:00:00Z", &FHIRMeta{LastUpdated: "2024-01-02T10:00:00Z"}},
+		{"", hl7v3DateTime("20240102100000.123-0500"), &FHIRMeta{LastUpdated: "2024-01-02T10:00:00-05:00"}},
+		{"", hl7v3DateTime("20240102100000"), nil},
+	}
+	for _, tt := range tests {
+		p := TUKPatient{Source: tt.source, LastUpdated: tt.lastUpdated}
+		pat := p.FHIR_Patient()
+		if !reflect.DeepEqual(pat.Meta, tt.want) {
+			t.Errorf("FHIR_Patient(%q, %q) meta = %+v, want %+v", tt.source, tt.lastUpdated, pat.Meta, tt.want)
+		}
+		b, _ := json.Marshal(pat)
+		if strings.Contains(string(b), `"meta"`) != (tt.want != nil) {
+			t.Errorf("FHIR_Patient(%q, %q) json = %s", tt.source, tt.lastUpdated, b)
+		}
+	}
+}
+
+func TestFHIRBundle(t *testing.T) {
+	patients := []TUKPatient{{Reference: "Patient/1", FamilyName: "Bloggs"}, {FamilyName: "Blogs"}}
+	for _, mode := range []string{tukcnst.PDQ_SERVER_TYPE_IHE_PIXM, PDQ_SERVER_TYPE_IHE_PDQM, tukcnst.PDQ_SERVER_TYPE_IHE_PDQV3} {
+		i := PDQQuery{Server_Mode: mode, Server_URL: "https://pix.example.nhs.uk/fhir/Patient?identifier=x", Patients: &patients}
+		bundle := i.FHIR_Bundle()
+		if bundle.ResourceType != "Bundle" || bundle.Type != FHIR_BUNDLE_TYPE_SEARCHSET || bundle.Total != 2 || len(bundle.Entry) != 2 || bundle.Entry[1].Resource.Name[0].Family != "Blogs" {
+			t.Errorf("%s: FHIR_Bundle() = %+v", mode, bundle)
+			continue
+		}
+		want := ""
+		if mode != tukcnst.PDQ_SERVER_TYPE_IHE_PDQV3 {
+			want = "https://pix.example.nhs.uk/fhir/Patient/1"
+		}
+		if bundle.Entry[0].FullUrl != want || bundle.Entry[1].FullUrl != "" {
+			t.Errorf("%s: FHIR_Bundle() fullUrls = %q %q, want %q", mode, bundle.Entry[0].FullUrl, bundle.Entry[1].FullUrl, want)
+		}
+	}
+	i := PDQQuery{}
+	if bundle := i.FHIR_Bundle(); bundle.Total != 0 || bundle.Entry != nil {
+		t.Errorf("FHIR_Bundle() without patients = %+v", bundle)
+	}
+}
+
+func TestSetFHIRPatient(t *testing.T) {
+	pat := FHIRPatient{
+		ResourceType: FHIR_RESOURCE_PATIENT,
+		Identifier: []FHIRIdentifier{
+			{System: "https://fhir.nhs.uk/Id/nhs-number", Value: "9999999468"},
+			{System: "urn:oid:2.16.840.1.113883.2.1.3.31.2.1.1", Value: "R1"},
+			{System: "urn:oid:1.2.3.4", Value: "M1"},
+			{System: "https://example.nhs.uk/id/local", Value: "L1"},
+			{System: "urn:oid:9.9", Value: ""},
+		},
+		Name:      []HumanName{{Use: "old", Given: []string{"Old"}, Family: "Name"}, {Use: "official", Given: []string{"Fred", "John"}, Family: "Bloggs"}},
+		Gender:    "male",
+		BirthDate: "1970-01-02",
+		Address:   []Address{{Use: "home", Line: []string{"1 Test Street", "Headingley"}, City: "Leeds", PostalCode: "LS6 2BB", Country: "GB"}},
+	}
+	i := PDQQuery{REG_OID: "2.16.840.1.113883.2.1.3.31.2.1.1", MRN_OID: "1.2.3.4"}
+	if err := i.Set_FHIR_Patient(pat); err != nil {
+		t.Fatalf("Set_FHIR_Patient() error = %v", err)
+	}
+	if i.NHS_ID != "9999999468" || i.REG_ID != "R1" || i.MRN_ID != "M1" || len(i.Identifiers) != 1 || i.Identifiers[0].Value != "L1" {
+		t.Errorf("Set_FHIR_Patient() ids = %q %q %q %+v", i.NHS_ID, i.REG_ID, i.MRN_ID, i.Identifiers)
+	}
+	if i.GivenName != "Fred John" || i.FamilyName != "Bloggs" || i.Gender != "male" || i.BirthDate != "19700102" || i.Street != "1 Test Street" ||
+		i.Town != "Headingley" || i.City != "Leeds" || i.Zip != "LS6 2BB" || i.Country != "GB" {
+		t.Errorf("Set_FHIR_Patient() demographics = %+v", i)
+	}
+	tp := TUKPatient{NHSOID: tukcnst.NHS_OID_DEFAULT, NHSID: "9999999468", GivenName: "Fred", FamilyName: "Bloggs", BirthDate: "19700102"}
+	i = PDQQuery{}
+	if err := i.Set_FHIR_Patient(tp.FHIR_Patient()); err != nil || i.NHS_ID != tp.NHSID || i.FamilyName != tp.FamilyName || i.BirthDate != tp.BirthDate {
+		t.Errorf("Set_FHIR_Patient(FHIR_Patient()) = %v, query = %+v", err, i)
+	}
+	if err := i.Set_FHIR_Patient(FHIRPatient{ResourceType: "Practitioner"}); err == nil {
+		t.Error("Set_FHIR_Patient(Practitioner) = nil, want error")
+	}
+}
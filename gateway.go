@@ -0,0 +1,173 @@
+package tukpdq
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ipthomas/tukcnst"
+)
+
+const (
+	ENV_PDQ_GATEWAY_API_KEY = "PDQ_GATEWAY_API_KEY"
+	GATEWAY_PATH_PATIENTS   = "/patients"
+	GATEWAY_PATH_SEARCH     = "/patients/search"
+	GATEWAY_PATH_HEALTH     = "/health"
+	GATEWAY_PARAM_NHS       = tukcnst.QUERY_PARAM_NHS
+	GATEWAY_PARAM_MRN       = "mrn"
+	GATEWAY_PARAM_OID       = "oid"
+	GATEWAY_PARAM_REG       = "reg"
+	GATEWAY_PARAM_RSP_TYPE  = "rsptype"
+	GATEWAY_API_KEY_HEADER  = "X-API-KEY"
+	GATEWAY_MAX_BODY_BYTES  = 64 * 1024
+	RSP_TYPE_BOOL           = "bool"
+	RSP_TYPE_CODE           = "code"
+)
+
+// Gateway_Config sets the gateway query template and optional X-API-KEY api key
+type Gateway_Config struct {
+	Template PDQQuery `json:",omitempty"`
+	API_Key  string   `json:"-"`
+}
+
+// GatewaySearch is the body of a POST /patients/search request. RspType is bool, code or empty for the patients
+type GatewaySearch struct {
+	NHS_ID      string      `json:"nhsid,omitempty"`
+	MRN_ID      string      `json:"mrnid,omitempty"`
+	MRN_OID     string      `json:"mrnoid,omitempty"`
+	REG_ID      string      `json:"regid,omitempty"`
+	Identifiers []PatientID `json:"identifiers,omitempty"`
+	GivenName   string      `json:"givenname,omitempty"`
+	FamilyName  string      `json:"familyname,omitempty"`
+	BirthDate   string      `json:"birthdate,omitempty"`
+	Gender      string      `json:"gender,omitempty"`
+	Zip         string      `json:"zip,omitempty"`
+	RspType     string      `json:"rsptype,omitempty"`
+}
+
+// Gateway is an http.Handler serving GET /patients and POST /patients/search patient lookups
+type Gateway struct {
+	cfg Gateway_Config
+	mux *http.ServeMux
+}
+
+// New_Gateway returns a Gateway that queries the server configured in the Template
+func New_Gateway(cfg Gateway_Config) *Gateway {
+	g := Gateway{cfg: cfg, mux: http.NewServeMux()}
+	g.mux.HandleFunc(GATEWAY_PATH_PATIENTS, g.getPatients)
+	g.mux.HandleFunc(GATEWAY_PATH_SEARCH, g.searchPatients)
+	g.mux.HandleFunc(GATEWAY_PATH_HEALTH, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return &g
+}
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+	if g.cfg.API_Key != "" && r.URL.Path != GATEWAY_PATH_HEALTH && subtle.ConstantTimeCompare([]byte(r.Header.Get(GATEWAY_API_KEY_HEADER)), []byte(g.cfg.API_Key)) != 1 {
+		writeGatewayError(w, http.StatusUnauthorized, "invalid request - api key is missing or invalid")
+		return
+	}
+	g.mux.ServeHTTP(w, r)
+}
+func (g *Gateway) getPatients(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeGatewayError(w, http.StatusMethodNotAllowed, "invalid request - method "+r.Method+" is not allowed")
+		return
+	}
+	params := r.URL.Query()
+	q := newQueryFrom(g.cfg.Template)
+	q.NHS_ID = params.Get(GATEWAY_PARAM_NHS)
+	q.MRN_ID = params.Get(GATEWAY_PARAM_MRN)
+	q.REG_ID = params.Get(GATEWAY_PARAM_REG)
+	if oid := params.Get(GATEWAY_PARAM_OID); oid != "" {
+		q.MRN_OID = oid
+	}
+	g.writePatients(w, q, params.Get(GATEWAY_PARAM_RSP_TYPE))
+}
+func (g *Gateway) searchPatients(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeGatewayError(w, http.StatusMethodNotAllowed, "invalid request - method "+r.Method+" is not allowed")
+		return
+	}
+	search := GatewaySearch{}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, GATEWAY_MAX_BODY_BYTES))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&search); err != nil {
+		writeGatewayError(w, http.StatusBadRequest, "invalid request - unable to decode search - "+err.Error())
+		return
+	}
+	q := newQueryFrom(g.cfg.Template)
+	q.NHS_ID, q.MRN_ID, q.REG_ID = search.NHS_ID, search.MRN_ID, search.REG_ID
+	if search.MRN_OID != "" {
+		q.MRN_OID = search.MRN_OID
+	}
+	q.Identifiers = append(q.Identifiers, search.Identifiers...)
+	q.GivenName, q.FamilyName, q.BirthDate, q.Gender, q.Zip = search.GivenName, search.FamilyName, search.BirthDate, search.Gender, search.Zip
+	g.writePatients(w, q, search.RspType)
+}
+
+// writePatients runs the query and writes the response for the RspType
+func (g *Gateway) writePatients(w http.ResponseWriter, q *PDQQuery, rspType string) {
+	switch rspType {
+	case "", RSP_TYPE_BOOL, RSP_TYPE_CODE:
+	default:
+		writeGatewayError(w, http.StatusBadRequest, "invalid request - rsptype "+rspType+" is not supported")
+		return
+	}
+	if err := New_Transaction(q); err != nil {
+		if status := gatewayStatus(err); status != http.StatusNoContent {
+			writeGatewayError(w, status, err.Error())
+			return
+		}
+		q.Patients = nil
+	}
+	found := q.Patients != nil && len(*q.Patients) > 0
+	switch {
+	case rspType == RSP_TYPE_BOOL:
+		writeGatewayJSON(w, http.StatusOK, found)
+	case !found:
+		w.WriteHeader(http.StatusNoContent)
+	case rspType == RSP_TYPE_CODE:
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeGatewayJSON(w, http.StatusOK, *q.Patients)
+	}
+}
+
+// gatewayStatus returns the http status for a query error
+func gatewayStatus(err error) int {
+	var verr *ValidationError
+	var cerr *ConfigurationError
+	var oerr *OutcomeError
+	switch {
+	case errors.As(err, &oerr) && oerr.Outcome == OUTCOME_SOURCE_IDENTIFIER_NOT_FOUND:
+		return http.StatusNoContent
+	case errors.As(err, &oerr) && oerr.Outcome == OUTCOME_SOURCE_DOMAIN_NOT_FOUND:
+		return http.StatusBadRequest
+	case errors.As(err, &verr):
+		return http.StatusBadRequest
+	case errors.As(err, &cerr):
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadGateway
+}
+func writeGatewayJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeGatewayError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set(tukcnst.CONTENT_TYPE, tukcnst.APPLICATION_JSON)
+	w.WriteHeader(status)
+	w.Write(b)
+}
+func writeGatewayError(w http.ResponseWriter, status int, msg string) {
+	b, _ := json.Marshal(map[string]string{"error": msg})
+	w.Header().Set(tukcnst.CONTENT_TYPE, tukcnst.APPLICATION_JSON)
+	w.WriteHeader(status)
+	w.Write(b)
+}
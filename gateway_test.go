@@ -0,0 +1,125 @@
+package tukpdq
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ipthomas/tukcnst"
+)
+
+func TestGatewayStatus(t *testing.T) {
+	pixm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/fhir+json")
+		switch {
+		case strings.Contains(r.URL.RawQuery, "9999999468"):
+			fmt.Fprint(w, `{"resourceType":"Bundle","total":1,"entry":[{"resource":{"resourceType":"Patient","id":"1","identifier":[{"system":"urn:oid:2.16.840.1.113883.2.1.4.1","value":"9999999468"}]}}]}`)
+		case strings.Contains(r.URL.RawQuery, "9434765919"):
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"resourceType":"OperationOutcome","issue":[{"severity":"error","code":"not-found","diagnostics":"sourceIdentifier Patient Identifier not found"}]}`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer pixm.Close()
+	g := New_Gateway(Gateway_Config{Template: PDQQuery{Server_Mode: "pixm", Server_URL: pixm.URL, REG_OID: "2.16.840.1.113883.2.1.3.31.2.1.1", HTTPClient: http.DefaultClient}})
+	tests := []struct {
+		name   string
+		target string
+		status int
+		body   string
+	}{
+		{"found", "/patients?nhs=9999999468&rsptype=code", http.StatusOK, ""},
+		{"not found", "/patients?nhs=9434765919", http.StatusNoContent, ""},
+		{"not found code", "/patients?nhs=9434765919&rsptype=code", http.StatusNoContent, ""},
+		{"not found bool", "/patients?nhs=9434765919&rsptype=bool", http.StatusOK, "false"},
+		{"invalid nhs number", "/patients?nhs=9434765918", http.StatusBadRequest, ""},
+		{"server error", "/patients?nhs=4010232137", http.StatusBadGateway, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		g.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if rec.Code != tt.status || (tt.body != "" && rec.Body.String() != tt.body) {
+			t.Errorf("%s: status = %v, body = %s, want %v %s", tt.name, rec.Code, rec.Body.String(), tt.status, tt.body)
+		}
+	}
+}
+
+func TestGatewayDemographicSearch(t *testing.T) {
+	pdqv3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rsp := `<Envelope><Body><PRPA_IN201306UV02><acknowledgement><typeCode code="AA"/></acknowledgement><controlActProcess><queryAck><resultTotalQuantity value="0"/></queryAck></controlActProcess></PRPA_IN201306UV02></Body></Envelope>`
+		if strings.Contains(string(body), "livingSubjectName") && !strings.Contains(string(body), "livingSubjectId") {
+			rsp = `<Envelope><Body><PRPA_IN201306UV02><acknowledgement><typeCode code="AA"/></acknowledgement><controlActProcess><subject><registrationEvent><subject1><patient><id root="2.16.840.1.113883.2.1.4.1" extension="9999999468"/><statusCode code="active"/><patientPerson><name><given>Fred</given><family>Bloggs</family></name></patientPerson></patient></subject1></registrationEvent></subject><queryAck><resultTotalQuantity value="1"/></queryAck></controlActProcess></PRPA_IN201306UV02></Body></Envelope>`
+		}
+		fmt.Fprint(w, rsp)
+	}))
+	defer pdqv3.Close()
+	search := `{"familyname": "Bloggs", "birthdate": "19800102", "rsptype": "bool"}`
+	tests := []struct {
+		mode   string
+		status int
+		body   string
+	}{
+		{"pdqv3", http.StatusOK, "true"},
+		{"pixm", http.StatusBadRequest, ""},
+		{"pdqv3 without sender", http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		template := PDQQuery{Server_Mode: tt.mode, Server_URL: pdqv3.URL, REG_OID: "2.16.840.1.113883.2.1.3.31.2.1.1", HTTPClient: http.DefaultClient,
+			Sender: HL7V3Device_Config{Application_OID: "2.16.840.1.113883.2.1.3.31.2.1.1.1.3"}}
+		if tt.mode == "pdqv3 without sender" {
+			template.Server_Mode, template.Sender = "pdqv3", HL7V3Device_Config{}
+		}
+		g := New_Gateway(Gateway_Config{Template: template})
+		rec := httptest.NewRecorder()
+		g.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, GATEWAY_PATH_SEARCH, strings.NewReader(search)))
+		if rec.Code != tt.status || (tt.body != "" && rec.Body.String() != tt.body) {
+			t.Errorf("%s: status = %v, body = %s, want %v %s", tt.mode, rec.Code, rec.Body.String(), tt.status, tt.body)
+		}
+	}
+}
+
+func TestGatewayErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"source identifier not found", &OutcomeError{StatusCode: http.StatusNotFound, Outcome: OUTCOME_SOURCE_IDENTIFIER_NOT_FOUND}, http.StatusNoContent},
+		{"source domain not found", &OutcomeError{StatusCode: http.StatusBadRequest, Outcome: OUTCOME_SOURCE_DOMAIN_NOT_FOUND}, http.StatusBadRequest},
+		{"target system not found", &OutcomeError{StatusCode: http.StatusForbidden, Outcome: OUTCOME_TARGET_SYSTEM_NOT_FOUND}, http.StatusBadGateway},
+		{"server error", &OutcomeError{StatusCode: http.StatusInternalServerError, Outcome: OUTCOME_SERVER_ERROR}, http.StatusBadGateway},
+		{"validation error", &ValidationError{Field: "nhs id", Value: "1", Reason: "is not 10 digits"}, http.StatusBadRequest},
+		{"validation errors", ValidationErrors{{Field: "gender", Value: "x", Reason: "is not an administrative gender code"}}, http.StatusBadRequest},
+		{"wrapped validation error", fmt.Errorf("query 1 - %w", &ValidationError{Field: "no patient id", Reason: "provided"}), http.StatusBadRequest},
+		{"configuration error", &ConfigurationError{Setting: "pdq server url", Reason: "is not set"}, http.StatusInternalServerError},
+		{"untyped invalid request", errors.New("invalid request - something else"), http.StatusBadGateway},
+		{"network error", errors.New("dial tcp: connection refused"), http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		if got := gatewayStatus(tt.err); got != tt.want {
+			t.Errorf("%s: gatewayStatus() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	for _, tt := range []struct {
+		name     string
+		template PDQQuery
+		want     int
+	}{
+		{"no server url", PDQQuery{Server_Mode: "pixm", REG_OID: "2.16.840.1.113883.2.1.3.31.2.1.1"}, http.StatusInternalServerError},
+		{"no reg oid", PDQQuery{Server_Mode: "pixm", Server_URL: "https://pix.example.nhs.uk/fhir/Patient"}, http.StatusInternalServerError},
+	} {
+		t.Setenv(tukcnst.ENV_REG_OID, "")
+		g := New_Gateway(Gateway_Config{Template: tt.template})
+		rec := httptest.NewRecorder()
+		g.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/patients?nhs=9999999468", nil))
+		if rec.Code != tt.want || !strings.Contains(rec.Body.String(), "is not set") {
+			t.Errorf("%s: status = %v, body = %s, want %v", tt.name, rec.Code, rec.Body.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package tukpdq
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	SURVIVORSHIP_MOST_RECENT   = "most recent"
+	SURVIVORSHIP_MOST_TRUSTED  = "most trusted"
+	SURVIVORSHIP_MOST_COMPLETE = "most complete"
+	SURVIVORSHIP_FIELD_IDS     = "ids"
+	SURVIVORSHIP_FIELD_NAME    = "name"
+	SURVIVORSHIP_FIELD_BIRTH   = "birthdate"
+	SURVIVORSHIP_FIELD_GENDER  = "gender"
+	SURVIVORSHIP_FIELD_ADDRESS = "address"
+	SURVIVORSHIP_FIELD_TELECOM = "telecom"
+	SURVIVORSHIP_FIELD_OTHER   = "other"
+)
+
+// Survivorship_Config sets how patient records are grouped and which record each golden record field is taken from
+type Survivorship_Config struct {
+	Rules           map[string]string `json:",omitempty"`
+	Default_Rule    string            `json:",omitempty"`
+	Trusted_Sources []string          `json:",omitempty"`
+	Match_Config    Match_Config      `json:",omitempty"`
+}
+
+// PatientGroup is a group of patient records for the same person and their golden record
+type PatientGroup struct {
+	Golden  TUKPatient     `json:"golden"`
+	Records []TUKPatient   `json:"records"`
+	Sources map[string]int `json:"sources,omitempty"`
+}
+
+var Default_Survivorship_Config = Survivorship_Config{
+	Rules:        map[string]string{SURVIVORSHIP_FIELD_IDS: SURVIVORSHIP_MOST_TRUSTED},
+	Default_Rule: SURVIVORSHIP_MOST_COMPLETE,
+	Match_Config: Default_Match_Config,
+}
+
+type survivorshipField struct {
+	completeness func(p TUKPatient) int
+	copy         func(dst *TUKPatient, src TUKPatient)
+}
+
+var survivorshipFields = map[string]survivorshipField{
+	SURVIVORSHIP_FIELD_IDS: {
+		completeness: func(p TUKPatient) int { return countSet(p.NHSID, p.REGID, p.PID) },
+		copy: func(dst *TUKPatient, src TUKPatient) {
+			dst.NHSOID, dst.NHSID, dst.REGOID, dst.REGID, dst.PIDOID, dst.PID = src.NHSOID, src.NHSID, src.REGOID, src.REGID, src.PIDOID, src.PID
+		},
+	},
+	SURVIVORSHIP_FIELD_NAME: {
+		completeness: func(p TUKPatient) int {
+			n := p.Usual_Name()
+			return countSet(p.GivenName, p.FamilyName) + len(n.Given) + len(n.Prefix) + len(n.Suffix)
+		},
+		copy: func(dst *TUKPatient, src TUKPatient) {
+			dst.GivenName, dst.FamilyName, dst.Names = src.GivenName, src.FamilyName, src.Names
+		},
+	},
+	SURVIVORSHIP_FIELD_BIRTH: {
+		completeness: func(p TUKPatient) int { return len(p.BirthDate) },
+		copy:         func(dst *TUKPatient, src TUKPatient) { dst.BirthDate = src.BirthDate },
+	},
+	SURVIVORSHIP_FIELD_GENDER: {
+		completeness: func(p TUKPatient) int { return len(normalisedGender(p.Gender)) },
+		copy:         func(dst *TUKPatient, src TUKPatient) { dst.Gender = src.Gender },
+	},
+	SURVIVORSHIP_FIELD_ADDRESS: {
+		completeness: func(p TUKPatient) int { return countSet(p.Street, p.Town, p.City, p.State, p.Country, p.Zip) },
+		copy: func(dst *TUKPatient, src TUKPatient) {
+			dst.Street, dst.Town, dst.City, dst.State, dst.Country, dst.Zip, dst.Addresses = src.Street, src.Town, src.City, src.State, src.Country, src.Zip, src.Addresses
+		},
+	},
+	SURVIVORSHIP_FIELD_TELECOM: {
+		completeness: func(p TUKPatient) int { return len(p.Telecom) },
+		copy:         func(dst *TUKPatient, src TUKPatient) { dst.Telecom = src.Telecom },
+	},
+	SURVIVORSHIP_FIELD_OTHER: {
+		completeness: func(p TUKPatient) int {
+			return countSet(p.MaritalStatus, p.BirthPlace) + countTrue(p.Deceased, p.MultipleBirth)
+		},
+		copy: func(dst *TUKPatient, src TUKPatient) {
+			dst.Deceased, dst.MultipleBirth, dst.MaritalStatus, dst.BirthPlace = src.Deceased, src.MultipleBirth, src.MaritalStatus, src.BirthPlace
+		},
+	},
+}
+
+// Group_Patients groups the patient records for the same person and builds the golden record of each group
+func Group_Patients(patients []TUKPatient, cfg Survivorship_Config) []PatientGroup {
+	parent := make([]int, len(patients))
+	ids := make([]map[string]string, len(patients))
+	for n := range parent {
+		parent[n] = n
+		ids[n] = patientIDs(patients[n])
+	}
+	var root func(n int) int
+	root = func(n int) int {
+		if parent[n] != n {
+			parent[n] = root(parent[n])
+		}
+		return parent[n]
+	}
+	join := func(x int, y int) {
+		rx, ry := root(x), root(y)
+		if rx != ry {
+			for domain, value := range ids[ry] {
+				ids[rx][domain] = value
+			}
+			parent[ry] = rx
+		}
+	}
+	for x := 0; x < len(patients); x++ {
+		for y := x + 1; y < len(patients); y++ {
+			if sharedID(ids[x], ids[y]) {
+				join(x, y)
+			}
+		}
+	}
+	for x := 0; x < len(patients); x++ {
+		for y := x + 1; y < len(patients); y++ {
+			if root(x) != root(y) && !conflictingIDs(ids[root(x)], ids[root(y)]) && Score_Patient(patients[x], patients[y], cfg.Match_Config).Classification == MATCH_RESULT_MATCH {
+				join(x, y)
+			}
+		}
+	}
+	groups := []PatientGroup{}
+	index := make(map[int]int)
+	for n, pat := range patients {
+		r := root(n)
+		g, ok := index[r]
+		if !ok {
+			g = len(groups)
+			index[r] = g
+			groups = append(groups, PatientGroup{})
+		}
+		groups[g].Records = append(groups[g].Records, pat)
+	}
+	for g := range groups {
+		groups[g].setGolden(cfg)
+	}
+	return groups
+}
+
+func sharedID(a map[string]string, b map[string]string) bool {
+	for domain, value := range a {
+		if b[domain] == value {
+			return true
+		}
+	}
+	return false
+}
+func conflictingIDs(a map[string]string, b map[string]string) bool {
+	for domain, value := range a {
+		if other, ok := b[domain]; ok && other != value {
+			return true
+		}
+	}
+	return false
+}
+func patientIDs(p TUKPatient) map[string]string {
+	ids := make(map[string]string)
+	for _, id := range []PatientID{{Value: p.NHSID, Authority: AssigningAuthority{OID: p.NHSOID}}, {Value: p.REGID, Authority: AssigningAuthority{OID: p.REGOID}}, {Value: p.PID, Authority: AssigningAuthority{OID: p.PIDOID}}} {
+		if id.Value != "" && id.Authority.OID != "" {
+			ids[id.Authority.OID] = id.Value
+		}
+	}
+	for _, id := range p.Identifiers {
+		if id.Value != "" && id.Authority.OID != "" {
+			ids[id.Authority.OID] = id.Value
+		}
+	}
+	return ids
+}
+
+// setGolden builds the group golden record from the survivorship rules
+func (g *PatientGroup) setGolden(cfg Survivorship_Config) {
+	g.Golden = TUKPatient{}
+	g.Sources = make(map[string]int)
+	for field, sf := range survivorshipFields {
+		rule := cfg.Rules[field]
+		if rule == "" {
+			rule = cfg.Default_Rule
+		}
+		if n := g.survivor(rule, sf, cfg.Trusted_Sources); n > -1 {
+			sf.copy(&g.Golden, g.Records[n])
+			g.Sources[field] = n
+		}
+	}
+	for n, rec := range g.Records {
+		for _, issue := range rec.Issues {
+			if !contains(g.Golden.Issues, issue) {
+				g.Golden.Issues = append(g.Golden.Issues, issue)
+			}
+		}
+		if !g.candidate(n) {
+			continue
+		}
+		if g.Golden.NHSID == "" {
+			g.Golden.NHSOID, g.Golden.NHSID = rec.NHSOID, rec.NHSID
+		}
+		if g.Golden.REGID == "" {
+			g.Golden.REGOID, g.Golden.REGID = rec.REGOID, rec.REGID
+		}
+		if g.Golden.PID == "" {
+			g.Golden.PIDOID, g.Golden.PID = rec.PIDOID, rec.PID
+		}
+		for _, id := range rec.Identifiers {
+			g.Golden.addIdentifier(id)
+		}
+		if rec.LastUpdated > g.Golden.LastUpdated {
+			g.Golden.LastUpdated = rec.LastUpdated
+		}
+	}
+}
+
+// candidate returns true if the record can contribute to the golden record
+func (g *PatientGroup) candidate(n int) bool {
+	if g.Records[n].isCurrent() {
+		return true
+	}
+	for _, rec := range g.Records {
+		if rec.isCurrent() {
+			return false
+		}
+	}
+	return true
+}
+
+// survivor returns the index of the record the field is taken from, or -1 if none has it
+func (g *PatientGroup) survivor(rule string, sf survivorshipField, trusted []string) int {
+	order := make([]int, 0, len(g.Records))
+	for n, rec := range g.Records {
+		if g.candidate(n) && sf.completeness(rec) > 0 {
+			order = append(order, n)
+		}
+	}
+	if len(order) == 0 {
+		return -1
+	}
+	trust := func(n int) int {
+		for t, source := range trusted {
+			if source == g.Records[n].Source {
+				return t
+			}
+		}
+		return len(trusted)
+	}
+	sort.SliceStable(order, func(x, y int) bool {
+		a, b := g.Records[order[x]], g.Records[order[y]]
+		switch rule {
+		case SURVIVORSHIP_MOST_RECENT:
+			return a.LastUpdated > b.LastUpdated
+		case SURVIVORSHIP_MOST_TRUSTED:
+			if trust(order[x]) != trust(order[y]) {
+				return trust(order[x]) < trust(order[y])
+			}
+			return a.LastUpdated > b.LastUpdated
+		}
+		return sf.completeness(a) > sf.completeness(b)
+	})
+	return order[0]
+}
+
+// addIdentifier adds the identifier if the patient does not already have it
+func (p *TUKPatient) addIdentifier(id PatientID) {
+	for _, pid := range p.Identifiers {
+		if pid.Value == id.Value && pid.Authority.OID == id.Authority.OID {
+			return
+		}
+	}
+	p.Identifiers = append(p.Identifiers, id)
+}
+
+// groupPatients sets Patient_Groups if Survivorship is set
+func (i *PDQQuery) groupPatients() {
+	if i.Survivorship == nil || i.Patients == nil {
+		return
+	}
+	i.Patient_Groups = Group_Patients(*i.Patients, *i.Survivorship)
+}
+func countSet(values ...string) int {
+	n := 0
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			n++
+		}
+	}
+	return n
+}
+func countTrue(values ...bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
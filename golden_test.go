@@ -0,0 +1,154 @@
+package tukpdq
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGroupPatientsSkipsMergedRecords(t *testing.T) {
+	patients := []TUKPatient{
+		{NHSID: "9999999468", NHSOID: "2.16.840.1.113883.2.1.4.1", FamilyName: "Merged", Zip: "LS1 4AP", LastUpdated: "2024-01-01", ReplacedBy: []string{"Patient/2"}},
+		{NHSID: "9999999468", NHSOID: "2.16.840.1.113883.2.1.4.1", FamilyName: "Survivor", REGID: "R2", REGOID: "2.16.840.1.113883.2.1.3.31.2.1.1", LastUpdated: "2023-01-01"},
+	}
+	groups := Group_Patients(patients, Survivorship_Config{Default_Rule: SURVIVORSHIP_MOST_RECENT, Match_Config: Default_Match_Config})
+	if len(groups) != 1 {
+		t.Fatalf("Group_Patients() = %v groups, want 1", len(groups))
+	}
+	golden := groups[0].Golden
+	if golden.FamilyName != "Survivor" || golden.Zip != "" || golden.REGID != "R2" || groups[0].Sources[SURVIVORSHIP_FIELD_NAME] != 1 {
+		t.Errorf("golden = %+v, sources = %v, want fields from the surviving record only", golden, groups[0].Sources)
+	}
+	groups = Group_Patients(patients[:1], Default_Survivorship_Config)
+	if groups[0].Golden.FamilyName != "Merged" {
+		t.Errorf("golden = %+v, want the merged record when the group has no active record", groups[0].Golden)
+	}
+}
+
+const (
+	testNHSOID = "2.16.840.1.113883.2.1.4.1"
+	testREGOID = "2.16.840.1.113883.2.1.3.31.2.1.1"
+)
+
+func groupedNames(groups []PatientGroup) [][]string {
+	got := [][]string{}
+	for _, g := range groups {
+		names := []string{}
+		for _, rec := range g.Records {
+			names = append(names, rec.FamilyName)
+		}
+		got = append(got, names)
+	}
+	return got
+}
+
+func TestGroupPatients(t *testing.T) {
+	tests := []struct {
+		name     string
+		patients []TUKPatient
+		want     [][]string
+	}{
+		{
+			name: "shared identifiers",
+			patients: []TUKPatient{
+				{FamilyName: "A", BirthDate: "1970-01-01", NHSOID: testNHSOID, NHSID: "9434765919"},
+				{FamilyName: "B", BirthDate: "1980-02-02", NHSOID: testNHSOID, NHSID: "9434765919", REGOID: testREGOID, REGID: "R1"},
+				{FamilyName: "C", BirthDate: "1990-03-03", Identifiers: []PatientID{{Value: "R1", Authority: AssigningAuthority{OID: testREGOID}}}},
+				{FamilyName: "D", BirthDate: "2000-04-04", NHSOID: testNHSOID, NHSID: "9999999468"},
+			},
+			want: [][]string{{"A", "B", "C"}, {"D"}},
+		},
+		{
+			name: "matching demographics",
+			patients: []TUKPatient{
+				{GivenName: "Fred", FamilyName: "Bloggs", BirthDate: "1970-01-02", Gender: "male", Zip: "LS1 4AP", NHSOID: testNHSOID, NHSID: "9434765919"},
+				{GivenName: "Jane", FamilyName: "Jones", BirthDate: "1985-06-07", Gender: "female", Zip: "M1 1AA", REGOID: testREGOID, REGID: "R1"},
+				{GivenName: "FRED", FamilyName: "Blogs", BirthDate: "19700102", Gender: "M", Zip: "LS14AP", REGOID: testREGOID, REGID: "R2"},
+			},
+			want: [][]string{{"Bloggs", "Blogs"}, {"Jones"}},
+		},
+		{
+			name: "conflicting identifiers",
+			patients: []TUKPatient{
+				{GivenName: "Fred", FamilyName: "Bloggs", BirthDate: "1970-01-02", NHSOID: testNHSOID, NHSID: "9434765919"},
+				{GivenName: "Fred", FamilyName: "Bloggs", BirthDate: "1970-01-02", NHSOID: testNHSOID, NHSID: "9999999468"},
+				{GivenName: "Fred", FamilyName: "Bloggs", BirthDate: "1970-01-02"},
+			},
+			want: [][]string{{"Bloggs", "Bloggs"}, {"Bloggs"}},
+		},
+	}
+	for _, tt := range tests {
+		groups := Group_Patients(tt.patients, Default_Survivorship_Config)
+		got := groupedNames(groups)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: Group_Patients() = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for g := range got {
+			if strings.Join(got[g], ",") != strings.Join(tt.want[g], ",") {
+				t.Errorf("%s: Group_Patients() = %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+	groups := Group_Patients(tests[2].patients, Default_Survivorship_Config)
+	if len(groups) != 2 || groups[0].Golden.NHSID != "9434765919" || groups[1].Golden.NHSID != "9999999468" {
+		t.Errorf("Group_Patients() golden NHS ids = %+v, want each NHS id in its own group", groups)
+	}
+}
+
+func TestSurvivorshipRules(t *testing.T) {
+	patients := []TUKPatient{
+		{
+			Source: "https://other.example.nhs.uk", LastUpdated: "2022-01-01T00:00:00Z", NHSOID: testNHSOID, NHSID: "9434765919",
+			GivenName: "Frederick", FamilyName: "Complete", Names: []HumanName{{Use: "official", Given: []string{"Frederick", "John"}, Family: "Complete"}},
+			BirthDate: "1970",
+		},
+		{
+			Source: "https://pds.example.nhs.uk", LastUpdated: "2021-01-01T00:00:00Z", NHSOID: testNHSOID, NHSID: "9434765919", REGOID: testREGOID, REGID: "R1",
+			GivenName: "Fred", FamilyName: "Trusted", BirthDate: "1970-01-02", Issues: []string{"patient status is nullified"},
+		},
+		{
+			Source: "https://pix.example.nhs.uk", LastUpdated: "2024-01-01T00:00:00Z", NHSOID: testNHSOID, NHSID: "9434765919",
+			FamilyName: "Recent", Zip: "LS1 4AP",
+		},
+	}
+	trusted := []string{"https://pds.example.nhs.uk", "https://pix.example.nhs.uk"}
+	tests := []struct {
+		rule   string
+		family string
+		source int
+	}{
+		{SURVIVORSHIP_MOST_RECENT, "Recent", 2},
+		{SURVIVORSHIP_MOST_TRUSTED, "Trusted", 1},
+		{SURVIVORSHIP_MOST_COMPLETE, "Complete", 0},
+	}
+	for _, tt := range tests {
+		cfg := Survivorship_Config{
+			Rules:           map[string]string{SURVIVORSHIP_FIELD_NAME: tt.rule, SURVIVORSHIP_FIELD_IDS: SURVIVORSHIP_MOST_TRUSTED},
+			Default_Rule:    SURVIVORSHIP_MOST_COMPLETE,
+			Trusted_Sources: trusted,
+			Match_Config:    Default_Match_Config,
+		}
+		groups := Group_Patients(patients, cfg)
+		if len(groups) != 1 {
+			t.Fatalf("%s: Group_Patients() = %v groups, want 1", tt.rule, len(groups))
+		}
+		g := groups[0]
+		if g.Golden.FamilyName != tt.family || g.Sources[SURVIVORSHIP_FIELD_NAME] != tt.source {
+			t.Errorf("%s: golden name = %q from record %v, want %q from record %v", tt.rule, g.Golden.FamilyName, g.Sources[SURVIVORSHIP_FIELD_NAME], tt.family, tt.source)
+		}
+		want := map[string]int{SURVIVORSHIP_FIELD_NAME: tt.source, SURVIVORSHIP_FIELD_IDS: 1, SURVIVORSHIP_FIELD_BIRTH: 1, SURVIVORSHIP_FIELD_ADDRESS: 2}
+		if len(g.Sources) != len(want) {
+			t.Errorf("%s: sources = %v, want %v", tt.rule, g.Sources, want)
+		}
+		for field, n := range want {
+			if got, ok := g.Sources[field]; !ok || got != n {
+				t.Errorf("%s: sources[%s] = %v, want %v", tt.rule, field, got, n)
+			}
+		}
+		if g.Golden.REGID != "R1" || g.Golden.BirthDate != "1970-01-02" || g.Golden.Zip != "LS1 4AP" || g.Golden.LastUpdated != "2024-01-01T00:00:00Z" ||
+			len(g.Golden.Issues) != 1 || len(g.Records) != 3 {
+			t.Errorf("%s: golden = %+v", tt.rule, g.Golden)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package tukpdq
+
+import (
+	"strings"
+)
+
+const (
+	HL7V2_SEGMENT_PID        = "PID"
+	HL7V2_REPETITION         = "~"
+	XDS_PID_FIELD_IDENTIFIER = "PID-3"
+	XDS_PID_FIELD_NAME       = "PID-5"
+	XDS_PID_FIELD_BIRTH_DATE = "PID-7"
+	XDS_PID_FIELD_SEX        = "PID-8"
+	XDS_PID_FIELD_ADDRESS    = "PID-11"
+)
+
+var hl7v2Escapes = strings.NewReplacer(`\`, `\E\`, "|", `\F\`, "^", `\S\`, "&", `\T\`, "~", `\R\`)
+
+// CX returns the identifier as an XDS HL7 v2 CX value, id^^^&oid&ISO
+func (id PatientID) CX() string {
+	switch {
+	case isOID(id.Authority.OID):
+		return hl7v2Escapes.Replace(id.Value) + "^^^&" + id.Authority.OID + "&" + HL7V2_UNIVERSAL_ID_ISO
+	case id.Authority.HL7V2_Namespace == "" && id.Authority.FHIR_System != "":
+		return hl7v2Escapes.Replace(id.Value) + "^^^&" + hl7v2Escapes.Replace(id.Authority.FHIR_System) + "&" + HL7V2_UNIVERSAL_ID_URI
+	}
+	return hl7v2Escapes.Replace(id.Value) + "^^^" + hl7v2Escapes.Replace(id.Authority.HL7V2_Namespace)
+}
+
+// PID_3 returns the patient identifiers as HL7 v2 PID-3 CX repetitions. Identifiers without an assigning authority are not included
+func (p *TUKPatient) PID_3() string {
+	return strings.Join(p.cxList(), HL7V2_REPETITION)
+}
+
+// PID_5 returns the patient names as HL7 v2 PID-5 XPN repetitions, family^given^further given names^suffix^prefix^^name type
+func (p *TUKPatient) PID_5() string {
+	names := p.Names
+	if len(names) == 0 && (p.GivenName != "" || p.FamilyName != "") {
+		names = []HumanName{{Given: strings.Fields(p.GivenName), Family: p.FamilyName}}
+	}
+	var xpns []string
+	for _, name := range names {
+		given, further := "", ""
+		if len(name.Given) > 0 {
+			given = name.Given[0]
+			further = strings.Join(name.Given[1:], " ")
+		}
+		xpns = append(xpns, hl7v2Components(name.Family, given, further, strings.Join(name.Suffix, " "), strings.Join(name.Prefix, " "), "", hl7v2NameType(name.Use)))
+	}
+	return strings.Join(xpns, HL7V2_REPETITION)
+}
+
+// PID_7 returns the patient birth date as an HL7 v2 PID-7 date, YYYYMMDD
+func (p *TUKPatient) PID_7() string {
+	return strings.ReplaceAll(p.BirthDate, "-", "")
+}
+
+// PID_8 returns the patient gender as an HL7 v2 PID-8 administrative sex code, M, F, O or U
+func (p *TUKPatient) PID_8() string {
+	switch normalisedGender(p.Gender) {
+	case "male":
+		return "M"
+	case "female":
+		return "F"
+	case "other":
+		return "O"
+	}
+	if p.Gender == "" {
+		return ""
+	}
+	return "U"
+}
+
+// PID_11 returns the patient addresses as HL7 v2 PID-11 XAD repetitions, street^other designation^city^state^zip^country^address type
+func (p *TUKPatient) PID_11() string {
+	addrs := p.Addresses
+	if len(addrs) == 0 && countSet(p.Street, p.Town, p.City, p.State, p.Zip, p.Country) > 0 {
+		addrs = []Address{{Line: []string{p.Street, p.Town}, City: p.City, State: p.State, PostalCode: p.Zip, Country: p.Country}}
+	}
+	var xads []string
+	for _, addr := range addrs {
+		street, other := "", ""
+		var lines []string
+		for _, line := range addr.Line {
+			if strings.TrimSpace(line) != "" {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) > 0 {
+			street = lines[0]
+			other = strings.Join(lines[1:], ", ")
+		}
+		xads = append(xads, hl7v2Components(street, other, addr.City, addr.State, addr.PostalCode, addr.Country, hl7v2AddressType(addr.Use, addr.Type)))
+	}
+	return strings.Join(xads, HL7V2_REPETITION)
+}
+
+// PID_Segment returns the patient as an HL7 v2 PID segment with PID-1, 3, 5, 7, 8 and 11 set
+func (p *TUKPatient) PID_Segment() string {
+	return strings.Join([]string{HL7V2_SEGMENT_PID, "1", "", p.PID_3(), "", p.PID_5(), "", p.PID_7(), p.PID_8(), "", "", p.PID_11()}, "|")
+}
+
+// XDS_Source_Patient_Info returns the XDS sourcePatientInfo slot values of the patient
+func (p *TUKPatient) XDS_Source_Patient_Info() []string {
+	var values []string
+	for _, cx := range p.cxList() {
+		values = append(values, XDS_PID_FIELD_IDENTIFIER+"|"+cx)
+	}
+	for _, field := range []struct{ name, value string }{
+		{XDS_PID_FIELD_NAME, p.PID_5()},
+		{XDS_PID_FIELD_BIRTH_DATE, p.PID_7()},
+		{XDS_PID_FIELD_SEX, p.PID_8()},
+		{XDS_PID_FIELD_ADDRESS, p.PID_11()},
+	} {
+		if field.value != "" {
+			values = append(values, field.name+"|"+field.value)
+		}
+	}
+	return values
+}
+
+// XDS_Source_Patient_ID returns the XDS sourcePatientId CX of the patient REG id
+func (p *TUKPatient) XDS_Source_Patient_ID() string {
+	if p.REGID == "" || p.REGOID == "" {
+		return ""
+	}
+	return PatientID{Value: p.REGID, Authority: Authority_From_OID(p.REGOID)}.CX()
+}
+
+// cxList returns the CX of the NHS, PID, REG and other patient identifiers with an assigning authority, without duplicates
+func (p *TUKPatient) cxList() []string {
+	var cxs []string
+	ids := []PatientID{
+		{Value: p.NHSID, Authority: Authority_From_OID(p.NHSOID)},
+		p.pidID(),
+		{Value: p.REGID, Authority: Authority_From_OID(p.REGOID)},
+	}
+	for _, id := range append(ids, p.Identifiers...) {
+		if id.Value == "" || (!isOID(id.Authority.OID) && id.Authority.HL7V2_Namespace == "" && id.Authority.FHIR_System == "") {
+			continue
+		}
+		if cx := id.CX(); !contains(cxs, cx) {
+			cxs = append(cxs, cx)
+		}
+	}
+	return cxs
+}
+
+// hl7v2Components returns the escaped values as HL7 v2 components with the trailing empty components removed
+func hl7v2Components(values ...string) string {
+	for n := range values {
+		values[n] = hl7v2Escapes.Replace(values[n])
+	}
+	return strings.TrimRight(strings.Join(values, "^"), "^")
+}
+
+// hl7v2NameType returns the HL7 v2 name type code for a FHIR name use
+func hl7v2NameType(use string) string {
+	switch use {
+	case "usual", "official":
+		return "L"
+	case "maiden":
+		return "M"
+	case "nickname":
+		return "N"
+	case "temp", "anonymous":
+		return "A"
+	}
+	return ""
+}
+
+// hl7v2AddressType returns the HL7 v2 address type code for a FHIR address use and type
+func hl7v2AddressType(use string, addrType string) string {
+	switch {
+	case use == "home":
+		return "H"
+	case use == "work":
+		return "O"
+	case use == "temp":
+		return "C"
+	case addrType == "postal":
+		return "M"
+	}
+	return ""
+}
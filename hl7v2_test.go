@@ -0,0 +1,96 @@
+package tukpdq
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ipthomas/tukcnst"
+)
+
+const testPIDOID = "2.16.840.1.113883.2.1.3.31.2.1.1.1.3.1.1"
+
+func newHL7V2TestPatient() TUKPatient {
+	return TUKPatient{
+		NHSOID: tukcnst.NHS_OID_DEFAULT,
+		NHSID:  "9999999468",
+		PIDOID: testPIDOID,
+		PID:    "M1|2^3",
+		Identifiers: []PatientID{
+			{Value: "L&1~2\\3", Authority: AssigningAuthority{HL7V2_Namespace: "LOCAL"}},
+			{Value: "X1", Authority: AssigningAuthority{FHIR_System: "https://fhir.trust.nhs.uk/Id/mrn"}},
+			{Value: "9999999468", Authority: Authority_From_OID(tukcnst.NHS_OID_DEFAULT)},
+			{Value: "N1", Authority: AssigningAuthority{Name: "No Authority"}},
+		},
+		Names: []HumanName{
+			{Use: "official", Prefix: []string{"Mr"}, Given: []string{"Fred", "John"}, Family: "O|Brien^Smith", Suffix: []string{"Jr"}},
+			{Use: "maiden", Family: "Jones"},
+		},
+		Gender:    "male",
+		BirthDate: "1970-01-02",
+		Addresses: []Address{
+			{Use: "home", Line: []string{"1 Test Street", "Flat 2", "Headingley"}, City: "Leeds", State: "West & Yorks", PostalCode: "LS6 2BB", Country: "GB"},
+			{Type: "postal", Line: []string{"PO Box 1"}, PostalCode: "LS1 1AA"},
+		},
+	}
+}
+
+func TestCX(t *testing.T) {
+	tests := []struct {
+		id   PatientID
+		want string
+	}{
+		{PatientID{Value: "9999999468", Authority: Authority_From_OID(tukcnst.NHS_OID_DEFAULT)}, "9999999468^^^&2.16.840.1.113883.2.1.4.1&ISO"},
+		{PatientID{Value: "M1|2^3", Authority: Authority_From_OID(testPIDOID)}, `M1\F\2\S\3^^^&` + testPIDOID + "&ISO"},
+		{PatientID{Value: "L&1~2\\3", Authority: AssigningAuthority{HL7V2_Namespace: "LO^CAL"}}, `L\T\1\R\2\E\3^^^LO\S\CAL`},
+		{PatientID{Value: "X1", Authority: AssigningAuthority{FHIR_System: "https://fhir.trust.nhs.uk/Id/mrn"}}, "X1^^^&https://fhir.trust.nhs.uk/Id/mrn&URI"},
+	}
+	for _, tt := range tests {
+		if got := tt.id.CX(); got != tt.want {
+			t.Errorf("%+v CX() = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestPIDSegment(t *testing.T) {
+	p := newHL7V2TestPatient()
+	pid3 := `9999999468^^^&2.16.840.1.113883.2.1.4.1&ISO~M1\F\2\S\3^^^&` + testPIDOID + `&ISO~L\T\1\R\2\E\3^^^LOCAL~X1^^^&https://fhir.trust.nhs.uk/Id/mrn&URI`
+	pid5 := `O\F\Brien\S\Smith^Fred^John^Jr^Mr^^L~Jones^^^^^^M`
+	pid11 := `1 Test Street^Flat 2, Headingley^Leeds^West \T\ Yorks^LS6 2BB^GB^H~PO Box 1^^^^LS1 1AA^^M`
+	want := "PID|1||" + pid3 + "||" + pid5 + "||19700102|M|||" + pid11
+	got := p.PID_Segment()
+	if got != want {
+		t.Errorf("PID_Segment() =\n%s\nwant\n%s", got, want)
+	}
+	fields := strings.Split(got, "|")
+	for n, value := range map[int]string{3: pid3, 5: pid5, 7: "19700102", 8: "M", 11: pid11} {
+		if len(fields) != 12 || fields[n] != value {
+			t.Errorf("PID-%v = %q, want %q", n, fields[n], value)
+		}
+	}
+	wantInfo := []string{
+		"PID-3|9999999468^^^&2.16.840.1.113883.2.1.4.1&ISO",
+		`PID-3|M1\F\2\S\3^^^&` + testPIDOID + "&ISO",
+		`PID-3|L\T\1\R\2\E\3^^^LOCAL`,
+		"PID-3|X1^^^&https://fhir.trust.nhs.uk/Id/mrn&URI",
+		"PID-5|" + pid5,
+		"PID-7|19700102",
+		"PID-8|M",
+		"PID-11|" + pid11,
+	}
+	if info := p.XDS_Source_Patient_Info(); !reflect.DeepEqual(info, wantInfo) {
+		t.Errorf("XDS_Source_Patient_Info() =\n%q\nwant\n%q", info, wantInfo)
+	}
+}
+
+func TestPIDSegmentFlatFields(t *testing.T) {
+	p := TUKPatient{NHSOID: tukcnst.NHS_OID_DEFAULT, NHSID: "9999999468", GivenName: "Fred John", FamilyName: "Bloggs", Gender: "unknown", Street: "1 Test Street", Zip: "LS1 4AP"}
+	want := "PID|1||9999999468^^^&2.16.840.1.113883.2.1.4.1&ISO||Bloggs^Fred^John|||U|||1 Test Street^^^^LS1 4AP"
+	if got := p.PID_Segment(); got != want {
+		t.Errorf("PID_Segment() =\n%s\nwant\n%s", got, want)
+	}
+	p = TUKPatient{PID: "M1"}
+	if got, info := p.PID_Segment(), p.XDS_Source_Patient_Info(); got != "PID|1||||||||||" || info != nil {
+		t.Errorf("PID_Segment() = %q, XDS_Source_Patient_Info() = %q, want empty fields", got, info)
+	}
+}
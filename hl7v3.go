@@ -0,0 +1,340 @@
+package tukpdq
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"github.com/ipthomas/tukcnst"
+	"github.com/ipthomas/tukutil"
+)
+
+const (
+	SOAP_ENVELOPE_NAMESPACE     = "http://www.w3.org/2003/05/soap-envelope"
+	WS_ADDRESSING_NAMESPACE     = "http://www.w3.org/2005/08/addressing"
+	WS_ADDRESSING_ANONYMOUS     = "http://www.w3.org/2005/08/addressing/anonymous"
+	HL7_INTERACTION_ID_ROOT     = "2.16.840.1.113883.1.6"
+	HL7_PIXV3_QUERY_INTERACTION = "PRPA_IN201309UV02"
+	HL7_PIXV3_QUERY_TRIGGER     = "PRPA_TE201309UV02"
+	HL7_PDQV3_QUERY_INTERACTION = "PRPA_IN201305UV02"
+	HL7_PDQV3_QUERY_TRIGGER     = "PRPA_TE201305UV02"
+)
+
+// SOAPEnvelope is a SOAP 1.2 envelope carrying a PIXv3 or PDQv3 query
+type SOAPEnvelope struct {
+	XMLName xml.Name   `xml:"http://www.w3.org/2003/05/soap-envelope Envelope"`
+	Header  SOAPHeader `xml:"http://www.w3.org/2003/05/soap-envelope Header"`
+	Body    SOAPBody   `xml:"http://www.w3.org/2003/05/soap-envelope Body"`
+}
+type SOAPHeader struct {
+	To        WSAValue    `xml:"http://www.w3.org/2005/08/addressing To"`
+	Action    WSAValue    `xml:"http://www.w3.org/2005/08/addressing Action"`
+	ReplyTo   WSAEndpoint `xml:"http://www.w3.org/2005/08/addressing ReplyTo"`
+	FaultTo   WSAEndpoint `xml:"http://www.w3.org/2005/08/addressing FaultTo"`
+	MessageID WSAValue    `xml:"http://www.w3.org/2005/08/addressing MessageID"`
+}
+type WSAValue struct {
+	MustUnderstand string `xml:"http://www.w3.org/2003/05/soap-envelope mustUnderstand,attr,omitempty"`
+	Value          string `xml:",chardata"`
+}
+type WSAEndpoint struct {
+	Address string `xml:"http://www.w3.org/2005/08/addressing Address"`
+}
+type SOAPBody struct {
+	PRPA_IN201309UV02 *PRPA_IN201309UV02 `xml:"urn:hl7-org:v3 PRPA_IN201309UV02,omitempty"`
+	PRPA_IN201305UV02 *PRPA_IN201305UV02 `xml:"urn:hl7-org:v3 PRPA_IN201305UV02,omitempty"`
+}
+type PRPA_IN201309UV02 struct {
+	HL7V3Transmission
+	ControlActProcess PIXv3ControlActProcess `xml:"controlActProcess"`
+}
+type PRPA_IN201305UV02 struct {
+	HL7V3Transmission
+	ControlActProcess PDQv3ControlActProcess `xml:"controlActProcess"`
+}
+
+// HL7V3Transmission holds the transmission wrapper elements common to all HL7v3 interactions
+type HL7V3Transmission struct {
+	ITSVersion         string           `xml:"ITSVersion,attr"`
+	ID                 HL7V3II          `xml:"id"`
+	CreationTime       HL7V3TS          `xml:"creationTime"`
+	VersionCode        HL7V3CS          `xml:"versionCode"`
+	InteractionId      HL7V3II          `xml:"interactionId"`
+	ProcessingCode     HL7V3CS          `xml:"processingCode"`
+	ProcessingModeCode HL7V3CS          `xml:"processingModeCode"`
+	AcceptAckCode      HL7V3CS          `xml:"acceptAckCode"`
+	Receiver           HL7V3Participant `xml:"receiver"`
+	Sender             HL7V3Participant `xml:"sender"`
+}
+type HL7V3II struct {
+	NullFlavor             string `xml:"nullFlavor,attr,omitempty"`
+	AssigningAuthorityName string `xml:"assigningAuthorityName,attr,omitempty"`
+	Extension              string `xml:"extension,attr,omitempty"`
+	Root                   string `xml:"root,attr,omitempty"`
+}
+type HL7V3CS struct {
+	Code       string `xml:"code,attr,omitempty"`
+	CodeSystem string `xml:"codeSystem,attr,omitempty"`
+}
+type HL7V3TS struct {
+	Value string `xml:"value,attr"`
+}
+type HL7V3Participant struct {
+	TypeCode string      `xml:"typeCode,attr"`
+	Device   HL7V3Device `xml:"device"`
+}
+type HL7V3Device struct {
+	ClassCode      string      `xml:"classCode,attr"`
+	DeterminerCode string      `xml:"determinerCode,attr"`
+	ID             HL7V3II     `xml:"id"`
+	AsAgent        *HL7V3Agent `xml:"asAgent,omitempty"`
+}
+type HL7V3Agent struct {
+	ClassCode               string            `xml:"classCode,attr"`
+	RepresentedOrganization HL7V3Organization `xml:"representedOrganization"`
+}
+type HL7V3Organization struct {
+	ClassCode      string  `xml:"classCode,attr"`
+	DeterminerCode string  `xml:"determinerCode,attr"`
+	ID             HL7V3II `xml:"id"`
+}
+type PIXv3ControlActProcess struct {
+	ClassCode        string                `xml:"classCode,attr"`
+	MoodCode         string                `xml:"moodCode,attr"`
+	Code             HL7V3CS               `xml:"code"`
+	QueryByParameter PIXv3QueryByParameter `xml:"queryByParameter"`
+}
+type PIXv3QueryByParameter struct {
+	QueryId              HL7V3II            `xml:"queryId"`
+	StatusCode           HL7V3CS            `xml:"statusCode"`
+	ResponsePriorityCode HL7V3CS            `xml:"responsePriorityCode"`
+	ParameterList        PIXv3ParameterList `xml:"parameterList"`
+}
+type PIXv3ParameterList struct {
+	DataSource        []HL7V3Parameter `xml:"dataSource,omitempty"`
+	PatientIdentifier HL7V3Parameter   `xml:"patientIdentifier"`
+}
+type PDQv3ControlActProcess struct {
+	ClassCode        string                `xml:"classCode,attr"`
+	MoodCode         string                `xml:"moodCode,attr"`
+	Code             HL7V3CS               `xml:"code"`
+	QueryByParameter PDQv3QueryByParameter `xml:"queryByParameter"`
+}
+type PDQv3QueryByParameter struct {
+	QueryId              HL7V3II            `xml:"queryId"`
+	StatusCode           HL7V3CS            `xml:"statusCode"`
+	ResponseModalityCode HL7V3CS            `xml:"responseModalityCode"`
+	ResponsePriorityCode HL7V3CS            `xml:"responsePriorityCode"`
+	MatchCriterionList   struct{}           `xml:"matchCriterionList"`
+	ParameterList        PDQv3ParameterList `xml:"parameterList"`
+}
+type PDQv3ParameterList struct {
+	LivingSubjectAdministrativeGender *PDQv3GenderParameter  `xml:"livingSubjectAdministrativeGender,omitempty"`
+	LivingSubjectBirthTime            *PDQv3TimeParameter    `xml:"livingSubjectBirthTime,omitempty"`
+	LivingSubjectId                   *HL7V3Parameter        `xml:"livingSubjectId,omitempty"`
+	LivingSubjectName                 *PDQv3NameParameter    `xml:"livingSubjectName,omitempty"`
+	PatientAddress                    *PDQv3AddressParameter `xml:"patientAddress,omitempty"`
+}
+type PDQv3GenderParameter struct {
+	Value         HL7V3CS `xml:"value"`
+	SemanticsText string  `xml:"semanticsText"`
+}
+type PDQv3TimeParameter struct {
+	Value         HL7V3TS `xml:"value"`
+	SemanticsText string  `xml:"semanticsText"`
+}
+type PDQv3NameParameter struct {
+	Value struct {
+		Given  []string `xml:"given,omitempty"`
+		Family string   `xml:"family,omitempty"`
+	} `xml:"value"`
+	SemanticsText string `xml:"semanticsText"`
+}
+type PDQv3AddressParameter struct {
+	Value struct {
+		StreetAddressLine []string `xml:"streetAddressLine,omitempty"`
+		City              string   `xml:"city,omitempty"`
+		PostalCode        string   `xml:"postalCode,omitempty"`
+		Country           string   `xml:"country,omitempty"`
+	} `xml:"value"`
+	SemanticsText string `xml:"semanticsText"`
+}
+type HL7V3Parameter struct {
+	Value         HL7V3II `xml:"value"`
+	SemanticsText string  `xml:"semanticsText"`
+}
+
+// HL7V3Device_Config identifies the sending or receiving application and facility of an HL7v3 message
+type HL7V3Device_Config struct {
+	Application_OID  string `json:",omitempty"`
+	Application_Name string `json:",omitempty"`
+	Facility_OID     string `json:",omitempty"`
+	Facility_Name    string `json:",omitempty"`
+}
+
+// Default HL7v3 sender, receiver and message id root for queries that do not set their own
+var (
+	Default_Sender          = HL7V3Device_Config{}
+	Default_Receiver        = HL7V3Device_Config{}
+	Default_Message_ID_Root = ""
+)
+
+func (i *PDQQuery) setHL7V3Devices() error {
+	if i.Sender.Application_OID == "" {
+		i.Sender = Default_Sender
+	}
+	if i.Receiver.Application_OID == "" {
+		i.Receiver = Default_Receiver
+	}
+	if i.Message_ID_Root == "" {
+		i.Message_ID_Root = Default_Message_ID_Root
+	}
+	if i.Sender.Application_OID == "" {
+		return &ConfigurationError{Setting: "sender application oid", Reason: "is not set"}
+	}
+	return nil
+}
+
+// newHL7V3ID returns a unique HL7v3 instance identifier
+func (i *PDQQuery) newHL7V3ID() HL7V3II {
+	uid := strings.ToUpper(tukutil.NewUuid())
+	if i.Message_ID_Root == "" {
+		return HL7V3II{Root: uid}
+	}
+	return HL7V3II{Root: i.Message_ID_Root, Extension: uid}
+}
+func (d HL7V3Device_Config) device() HL7V3II {
+	if d.Application_OID == "" {
+		return HL7V3II{NullFlavor: "UNK"}
+	}
+	return HL7V3II{Root: d.Application_OID, AssigningAuthorityName: d.Application_Name}
+}
+func (d HL7V3Device_Config) facility() *HL7V3Agent {
+	if d.Facility_OID == "" {
+		return nil
+	}
+	return &HL7V3Agent{
+		ClassCode: "AGNT",
+		RepresentedOrganization: HL7V3Organization{
+			ClassCode:      "ORG",
+			DeterminerCode: "INSTANCE",
+			ID:             HL7V3II{Root: d.Facility_OID, AssigningAuthorityName: d.Facility_Name},
+		},
+	}
+}
+func newSOAPEnvelope(to string, action string) SOAPEnvelope {
+	return SOAPEnvelope{
+		XMLName: xml.Name{Space: SOAP_ENVELOPE_NAMESPACE, Local: "Envelope"},
+		Header: SOAPHeader{
+			To:        WSAValue{Value: to},
+			Action:    WSAValue{MustUnderstand: "true", Value: action},
+			ReplyTo:   WSAEndpoint{Address: WS_ADDRESSING_ANONYMOUS},
+			FaultTo:   WSAEndpoint{Address: WS_ADDRESSING_ANONYMOUS},
+			MessageID: WSAValue{Value: "uuid:" + tukutil.NewUuid()},
+		},
+	}
+}
+func (i *PDQQuery) newHL7V3Transmission(interaction string) HL7V3Transmission {
+	return HL7V3Transmission{
+		ITSVersion:         "XML_1.0",
+		ID:                 i.newHL7V3ID(),
+		CreationTime:       HL7V3TS{Value: tukutil.SimpleDateTime()},
+		VersionCode:        HL7V3CS{Code: "V3PR1"},
+		InteractionId:      HL7V3II{Extension: interaction, Root: HL7_INTERACTION_ID_ROOT},
+		ProcessingCode:     HL7V3CS{Code: "P"},
+		ProcessingModeCode: HL7V3CS{Code: "T"},
+		AcceptAckCode:      HL7V3CS{Code: "AL"},
+		Receiver:           newHL7V3Participant("RCV", i.Receiver),
+		Sender:             newHL7V3Participant("SND", i.Sender),
+	}
+}
+func newHL7V3Participant(typeCode string, d HL7V3Device_Config) HL7V3Participant {
+	return HL7V3Participant{
+		TypeCode: typeCode,
+		Device: HL7V3Device{
+			ClassCode:      "DEV",
+			DeterminerCode: "INSTANCE",
+			ID:             d.device(),
+			AsAgent:        d.facility(),
+		},
+	}
+}
+
+// newPIXv3Request returns the SOAP envelope for an IHE PIXv3 (ITI-45) query
+func (i *PDQQuery) newPIXv3Request() SOAPEnvelope {
+	msg := PRPA_IN201309UV02{HL7V3Transmission: i.newHL7V3Transmission(HL7_PIXV3_QUERY_INTERACTION)}
+	msg.ControlActProcess = PIXv3ControlActProcess{
+		ClassCode: "CACT",
+		MoodCode:  "EVN",
+		Code:      HL7V3CS{Code: HL7_PIXV3_QUERY_TRIGGER, CodeSystem: HL7_INTERACTION_ID_ROOT},
+		QueryByParameter: PIXv3QueryByParameter{
+			QueryId:              i.newHL7V3ID(),
+			StatusCode:           HL7V3CS{Code: "new"},
+			ResponsePriorityCode: HL7V3CS{Code: "I"},
+			ParameterList: PIXv3ParameterList{
+				PatientIdentifier: HL7V3Parameter{
+					Value:         HL7V3II{AssigningAuthorityName: Authority_From_OID(i.Used_PID_OID).Display_Name(), Extension: i.Used_PID, Root: i.Used_PID_OID},
+					SemanticsText: "Patient.id",
+				},
+			},
+		},
+	}
+	for _, domain := range i.Target_Domains {
+		msg.ControlActProcess.QueryByParameter.ParameterList.DataSource = append(msg.ControlActProcess.QueryByParameter.ParameterList.DataSource, HL7V3Parameter{
+			Value:         HL7V3II{Root: OID_From_System(domain)},
+			SemanticsText: "DataSource.id",
+		})
+	}
+	env := newSOAPEnvelope(i.Server_URL, tukcnst.SOAP_ACTION_PIXV3_Request)
+	env.Body.PRPA_IN201309UV02 = &msg
+	return env
+}
+
+// newPDQv3ParameterList returns the PDQv3 query parameters. The Used_PID is sent if set, otherwise the query demographics are sent
+func (i *PDQQuery) newPDQv3ParameterList() PDQv3ParameterList {
+	params := PDQv3ParameterList{}
+	if i.Used_PID != "" {
+		params.LivingSubjectId = &HL7V3Parameter{Value: HL7V3II{Extension: i.Used_PID, Root: i.Used_PID_OID}, SemanticsText: "LivingSubject.id"}
+		return params
+	}
+	if code := cdaGender(i.Gender); code != "" {
+		params.LivingSubjectAdministrativeGender = &PDQv3GenderParameter{Value: HL7V3CS{Code: code, CodeSystem: HL7_ADMINISTRATIVE_GENDER_OID}, SemanticsText: "LivingSubject.administrativeGender"}
+	}
+	if i.BirthDate != "" {
+		params.LivingSubjectBirthTime = &PDQv3TimeParameter{Value: HL7V3TS{Value: strings.ReplaceAll(i.BirthDate, "-", "")}, SemanticsText: "LivingSubject.birthTime"}
+	}
+	if i.GivenName != "" || i.FamilyName != "" {
+		params.LivingSubjectName = &PDQv3NameParameter{SemanticsText: "LivingSubject.name"}
+		params.LivingSubjectName.Value.Given = strings.Fields(i.GivenName)
+		params.LivingSubjectName.Value.Family = i.FamilyName
+	}
+	if countSet(i.Street, i.Town, i.City, i.Zip, i.Country) > 0 {
+		params.PatientAddress = &PDQv3AddressParameter{SemanticsText: "Patient.addr"}
+		for _, line := range []string{i.Street, i.Town} {
+			if line != "" {
+				params.PatientAddress.Value.StreetAddressLine = append(params.PatientAddress.Value.StreetAddressLine, line)
+			}
+		}
+		params.PatientAddress.Value.City, params.PatientAddress.Value.PostalCode, params.PatientAddress.Value.Country = i.City, i.Zip, i.Country
+	}
+	return params
+}
+
+// newPDQv3Request returns the SOAP envelope for an IHE PDQv3 (ITI-47) query
+func (i *PDQQuery) newPDQv3Request() SOAPEnvelope {
+	msg := PRPA_IN201305UV02{HL7V3Transmission: i.newHL7V3Transmission(HL7_PDQV3_QUERY_INTERACTION)}
+	msg.ControlActProcess = PDQv3ControlActProcess{
+		ClassCode: "CACT",
+		MoodCode:  "EVN",
+		Code:      HL7V3CS{Code: HL7_PDQV3_QUERY_TRIGGER, CodeSystem: HL7_INTERACTION_ID_ROOT},
+		QueryByParameter: PDQv3QueryByParameter{
+			QueryId:              i.newHL7V3ID(),
+			StatusCode:           HL7V3CS{Code: "new"},
+			ResponseModalityCode: HL7V3CS{Code: "R"},
+			ResponsePriorityCode: HL7V3CS{Code: "I"},
+			ParameterList:        i.newPDQv3ParameterList(),
+		},
+	}
+	env := newSOAPEnvelope(i.Server_URL, tukcnst.SOAP_ACTION_PDQV3_Request)
+	env.Body.PRPA_IN201305UV02 = &msg
+	return env
+}
@@ -0,0 +1,151 @@
+package tukpdq
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ipthomas/tukcnst"
+)
+
+func newHL7V3TestQuery() *PDQQuery {
+	return &PDQQuery{
+		Server_URL:      "https://pix.example.nhs.uk/pixv3",
+		Used_PID:        "9999999468",
+		Used_PID_OID:    tukcnst.NHS_OID_DEFAULT,
+		Target_Domains:  []string{"2.16.840.1.113883.2.1.3.31.2.1.1"},
+		Message_ID_Root: "2.16.840.1.113883.2.1.3.31.2.1.1.1.3.9",
+		Sender:          HL7V3Device_Config{Application_OID: "2.16.840.1.113883.2.1.3.31.2.1.1.1.3", Application_Name: "ICB_XDS", Facility_OID: "2.16.840.1.113883.2.1.3.31"},
+		Receiver:        HL7V3Device_Config{Application_OID: "2.16.840.1.113883.2.1.3.31.2.1.1.1.4"},
+	}
+}
+
+func TestSOAPEnvelopeRoundTrip(t *testing.T) {
+	i := newHL7V3TestQuery()
+	tests := []struct {
+		name   string
+		env    SOAPEnvelope
+		action string
+	}{
+		{"pixv3", i.newPIXv3Request(), tukcnst.SOAP_ACTION_PIXV3_Request},
+		{"pdqv3", i.newPDQv3Request(), tukcnst.SOAP_ACTION_PDQV3_Request},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := xml.Marshal(tt.env)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			got := SOAPEnvelope{}
+			if err = xml.Unmarshal(b, &got); err != nil {
+				t.Fatalf("unmarshal: %v\n%s", err, b)
+			}
+			if !reflect.DeepEqual(got, tt.env) {
+				t.Errorf("round trip mismatch\ngot  %+v\nwant %+v\n%s", got, tt.env, b)
+			}
+			if got.XMLName.Space != SOAP_ENVELOPE_NAMESPACE || got.Header.Action.Value != tt.action || got.Header.To.Value != i.Server_URL {
+				t.Errorf("envelope header not set, got %+v %+v", got.XMLName, got.Header)
+			}
+		})
+	}
+}
+
+func TestSOAPEnvelopeContent(t *testing.T) {
+	i := newHL7V3TestQuery()
+	pix := i.newPIXv3Request().Body.PRPA_IN201309UV02
+	if pix == nil {
+		t.Fatal("pixv3 request body is not set")
+	}
+	params := pix.ControlActProcess.QueryByParameter.ParameterList
+	if params.PatientIdentifier.Value.Extension != i.Used_PID || params.PatientIdentifier.Value.Root != i.Used_PID_OID {
+		t.Errorf("pixv3 patient identifier = %+v", params.PatientIdentifier.Value)
+	}
+	if len(params.DataSource) != 1 || params.DataSource[0].Value.Root != i.Target_Domains[0] {
+		t.Errorf("pixv3 data source = %+v", params.DataSource)
+	}
+	if pix.Sender.Device.ID.Root != i.Sender.Application_OID || pix.Sender.Device.AsAgent == nil || pix.Receiver.Device.AsAgent != nil {
+		t.Errorf("pixv3 devices = %+v %+v", pix.Sender, pix.Receiver)
+	}
+	if pix.ID.Root != i.Message_ID_Root || pix.ID.Extension == "" {
+		t.Errorf("pixv3 message id = %+v", pix.ID)
+	}
+	pdq := i.newPDQv3Request().Body.PRPA_IN201305UV02
+	if pdq == nil || pdq.ControlActProcess.QueryByParameter.ParameterList.LivingSubjectId == nil {
+		t.Fatal("pdqv3 request living subject id is not set")
+	}
+	if id := pdq.ControlActProcess.QueryByParameter.ParameterList.LivingSubjectId.Value; id.Extension != i.Used_PID || id.Root != i.Used_PID_OID {
+		t.Errorf("pdqv3 living subject id = %+v", id)
+	}
+	b, _ := xml.Marshal(i.newPDQv3Request())
+	if !strings.Contains(string(b), `<PRPA_IN201305UV02 xmlns="urn:hl7-org:v3"`) {
+		t.Errorf("pdqv3 body is not in the hl7 v3 namespace\n%s", b)
+	}
+}
+
+func TestPDQv3DemographicParameters(t *testing.T) {
+	i := newHL7V3TestQuery()
+	i.Used_PID, i.Used_PID_OID = "", ""
+	i.GivenName, i.FamilyName, i.BirthDate, i.Gender, i.Zip = "Fred John", "Bloggs", "1980-01-02", "male", "LS1 4AP"
+	params := i.newPDQv3Request().Body.PRPA_IN201305UV02.ControlActProcess.QueryByParameter.ParameterList
+	if params.LivingSubjectId != nil {
+		t.Errorf("living subject id = %+v, want none", params.LivingSubjectId)
+	}
+	if params.LivingSubjectName == nil || params.LivingSubjectName.Value.Family != "Bloggs" || len(params.LivingSubjectName.Value.Given) != 2 {
+		t.Errorf("living subject name = %+v", params.LivingSubjectName)
+	}
+	if params.LivingSubjectBirthTime == nil || params.LivingSubjectBirthTime.Value.Value != "19800102" {
+		t.Errorf("living subject birth time = %+v", params.LivingSubjectBirthTime)
+	}
+	if params.LivingSubjectAdministrativeGender == nil || params.LivingSubjectAdministrativeGender.Value.Code != "M" {
+		t.Errorf("living subject gender = %+v", params.LivingSubjectAdministrativeGender)
+	}
+	if params.PatientAddress == nil || params.PatientAddress.Value.PostalCode != "LS1 4AP" {
+		t.Errorf("patient address = %+v", params.PatientAddress)
+	}
+}
+
+func TestSetHL7V3DevicesDefaults(t *testing.T) {
+	i := PDQQuery{}
+	if err := i.setHL7V3Devices(); err == nil || err.Error() != "invalid request - sender application oid is not set" {
+		t.Errorf("setHL7V3Devices() error = %v, want sender application oid is not set", err)
+	}
+	own := HL7V3Device_Config{Application_OID: "2.16.840.1.113883.2.1.3.31.2.1.1.1.3"}
+	Default_Sender = own
+	defer func() { Default_Sender = HL7V3Device_Config{} }()
+	i = PDQQuery{}
+	if err := i.setHL7V3Devices(); err != nil || i.Sender != own {
+		t.Errorf("sender = %+v, error = %v, want Default_Sender %+v", i.Sender, err, own)
+	}
+	Default_Sender = HL7V3Device_Config{}
+	i = PDQQuery{Sender: own}
+	if err := i.setHL7V3Devices(); err != nil || i.Sender != own {
+		t.Errorf("sender = %+v, error = %v, want %+v", i.Sender, err, own)
+	}
+}
+
+func TestSOAPEnvelopeEscaping(t *testing.T) {
+	i := newHL7V3TestQuery()
+	i.Used_PID = `M"1<2&3`
+	i.Used_PID_OID = `1.2"<&.3`
+	for name, env := range map[string]SOAPEnvelope{"pixv3": i.newPIXv3Request(), "pdqv3": i.newPDQv3Request()} {
+		b, err := xml.Marshal(env)
+		if err != nil {
+			t.Fatalf("%s marshal: %v", name, err)
+		}
+		s := string(b)
+		if strings.Contains(s, i.Used_PID) || strings.Contains(s, i.Used_PID_OID) {
+			t.Errorf("%s request contains the unescaped patient id or oid\n%s", name, s)
+		}
+		if !strings.Contains(s, `extension="M&#34;1&lt;2&amp;3"`) || !strings.Contains(s, `root="1.2&#34;&lt;&amp;.3"`) {
+			t.Errorf("%s request does not contain the escaped patient id and oid\n%s", name, s)
+		}
+		got := SOAPEnvelope{}
+		if err = xml.Unmarshal(b, &got); err != nil {
+			t.Fatalf("%s unmarshal: %v\n%s", name, err, s)
+		}
+		if !reflect.DeepEqual(got, env) {
+			t.Errorf("%s round trip mismatch\ngot  %+v\nwant %+v", name, got, env)
+		}
+	}
+}
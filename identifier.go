@@ -0,0 +1,194 @@
+package tukpdq
+
+import "log"
+
+// PatientID is a patient identifier value in an identifier domain described by its assigning authority
+type PatientID struct {
+	Value     string             `json:"value"`
+	Use       string             `json:"use,omitempty"`
+	Authority AssigningAuthority `json:"authority"`
+}
+
+// New_PatientID returns a PatientID for the value in the domain of the OID, urn:oid: URI or FHIR system
+func New_PatientID(system string, value string) PatientID {
+	aa, _ := Authority_From_System(system)
+	return PatientID{Value: value, Authority: aa}
+}
+
+// Get_ID returns the patient identifier value in the domain with the given OID
+func (p *TUKPatient) Get_ID(oid string) string {
+	for _, id := range p.Identifiers {
+		if id.Authority.OID == oid {
+			return id.Value
+		}
+	}
+	return ""
+}
+
+// pidID returns the patient PID as a PatientID
+func (p *TUKPatient) pidID() PatientID {
+	if p.PIDOID == "" && p.PIDSystem != "" {
+		return PatientID{Value: p.PID, Authority: AssigningAuthority{FHIR_System: p.PIDSystem}}
+	}
+	return PatientID{Value: p.PID, Authority: Authority_From_OID(p.PIDOID)}
+}
+
+// addID sets the patient NHS, REG or PID fields and adds the identifier if it is in a target domain
+func (p *TUKPatient) addID(i *PDQQuery, id PatientID) {
+	if id.Value == "" {
+		return
+	}
+	switch id.Authority.OID {
+	case "":
+	case i.NHS_OID:
+		if issue := checkNHSID(id.Value); issue != "" {
+			p.Issues = append(p.Issues, issue)
+			i.Issues = append(i.Issues, issue)
+		} else {
+			id.Value = Normalise_NHS_Number(id.Value)
+		}
+		p.NHSOID = id.Authority.OID
+		p.NHSID = id.Value
+	case i.REG_OID:
+		p.REGOID = id.Authority.OID
+		p.REGID = id.Value
+	case i.MRN_OID:
+		p.PIDOID = id.Authority.OID
+		p.PID = id.Value
+	}
+	if i.inTargetDomains(id) {
+		p.addIdentifier(id)
+	}
+}
+
+// newHL7V3PatientID returns the PatientID for an HL7v3 II
+func newHL7V3PatientID(root string, extension string, aaName string) PatientID {
+	aa := Authority_From_OID(root)
+	if aa.Name == "" {
+		aa.Name = aaName
+	}
+	return PatientID{Value: extension, Authority: aa}
+}
+
+// setQueryPatient copies the ids and demographics of the patient the query resolved to into the query
+func (i *PDQQuery) setQueryPatient() {
+	if pat, ok := i.resolvedPatient(); ok {
+		i.setQueryIDs(pat)
+		i.setQueryDemographics(pat)
+	}
+}
+
+// resolvedPatient returns the single active patient the query resolved to
+func (i *PDQQuery) resolvedPatient() (TUKPatient, bool) {
+	if i.Patients == nil {
+		return TUKPatient{}, false
+	}
+	current := []TUKPatient{}
+	for _, pat := range *i.Patients {
+		if pat.isCurrent() {
+			current = append(current, pat)
+		}
+	}
+	if len(current) == 1 {
+		return current[0], true
+	}
+	for _, pat := range current {
+		if i.Used_PID != "" && pat.idIn(i.Used_PID_OID) == i.Used_PID {
+			return pat, true
+		}
+	}
+	log.Printf("Query ids not set, %v active patients returned and none has id %s %s", len(current), i.Used_PID, i.Used_PID_OID)
+	return TUKPatient{}, false
+}
+
+// idIn returns the patient id in the domain with the given OID from the NHS, PID or REG fields or the patient identifiers
+func (p *TUKPatient) idIn(oid string) string {
+	switch {
+	case oid == "":
+		return ""
+	case p.NHSOID == oid && p.NHSID != "":
+		return p.NHSID
+	case p.PIDOID == oid && p.PID != "":
+		return p.PID
+	case p.REGOID == oid && p.REGID != "":
+		return p.REGID
+	}
+	return p.Get_ID(oid)
+}
+
+// setQueryIDs copies the patient NHS, REG and MRN identifiers into any unset query ids
+func (i *PDQQuery) setQueryIDs(pat TUKPatient) {
+	if pat.REGID != "" && i.REG_ID == "" {
+		i.REG_ID = pat.REGID
+		log.Printf("Set Reg ID %s %s", i.REG_ID, i.REG_OID)
+	}
+	if pat.PID != "" && pat.PIDOID != "" && i.MRN_ID == "" && (i.MRN_OID == "" || i.MRN_OID == pat.PIDOID) {
+		i.MRN_ID = pat.PID
+		i.MRN_OID = pat.PIDOID
+		log.Printf("Set PID %s %s", i.MRN_ID, i.MRN_OID)
+	}
+	if pat.NHSID != "" && i.NHS_ID == "" {
+		i.NHS_ID = pat.NHSID
+		log.Printf("Set NHS ID %s %s", i.NHS_ID, i.NHS_OID)
+	}
+}
+
+// setQueryDemographics copies the patient demographics found in the response into the query
+func (i *PDQQuery) setQueryDemographics(pat TUKPatient) {
+	i.GivenName = pat.GivenName
+	i.FamilyName = pat.FamilyName
+	i.BirthDate = pat.BirthDate
+	i.Gender = pat.Gender
+	i.Zip = pat.Zip
+	i.Street = pat.Street
+	i.Town = pat.Town
+	i.City = pat.City
+	i.Country = pat.Country
+}
+
+// setIdentifiers copies the query identifiers in the NHS, MRN or REG domains into any unset query fields
+func (i *PDQQuery) setIdentifiers() {
+	for n, id := range i.Identifiers {
+		if id.Authority.OID == "" && id.Authority.FHIR_System != "" {
+			i.Identifiers[n] = New_PatientID(id.Authority.FHIR_System, id.Value)
+			id = i.Identifiers[n]
+		}
+		switch id.Authority.OID {
+		case "":
+		case i.NHS_OID:
+			if i.NHS_ID == "" {
+				i.NHS_ID = id.Value
+			}
+		case i.REG_OID:
+			if i.REG_ID == "" {
+				i.REG_ID = id.Value
+			}
+		case i.MRN_OID:
+			if i.MRN_ID == "" {
+				i.MRN_ID = id.Value
+			}
+		}
+	}
+}
+
+// inTargetDomains returns true if no target domains are set in the query or the identifier domain is one of the target domains
+func (i *PDQQuery) inTargetDomains(id PatientID) bool {
+	if len(i.Target_Domains) == 0 {
+		return true
+	}
+	for _, domain := range i.Target_Domains {
+		if OID_From_System(domain) == id.Authority.OID {
+			return true
+		}
+	}
+	return false
+}
+func (i *PDQQuery) addPatient(pat TUKPatient) {
+	if pat.Source == "" {
+		pat.Source = i.Server_URL
+	}
+	if i.Patients == nil {
+		i.Patients = &[]TUKPatient{}
+	}
+	*i.Patients = append(*i.Patients, pat)
+}
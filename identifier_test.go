@@ -0,0 +1,37 @@
+package tukpdq
+
+import (
+	"testing"
+
+	"github.com/ipthomas/tukcnst"
+)
+
+func TestSetQueryPatient(t *testing.T) {
+	searched := TUKPatient{NHSID: "9999999468", NHSOID: tukcnst.NHS_OID_DEFAULT, REGID: "R1", FamilyName: "Searched"}
+	other := TUKPatient{NHSID: "9434765919", NHSOID: tukcnst.NHS_OID_DEFAULT, REGID: "R2", PID: "M2", PIDOID: "1.2.3", FamilyName: "Other"}
+	tests := []struct {
+		name     string
+		query    PDQQuery
+		patients []TUKPatient
+		nhs      string
+		reg      string
+		mrn      string
+		family   string
+	}{
+		{"single patient", PDQQuery{}, []TUKPatient{other}, "9434765919", "R2", "M2", "Other"},
+		{"query ids kept", PDQQuery{NHS_ID: "9999999468", MRN_ID: "M9"}, []TUKPatient{other}, "9999999468", "R2", "M9", "Other"},
+		{"mrn in other domain", PDQQuery{MRN_OID: "1.2.4"}, []TUKPatient{other}, "9434765919", "R2", "", "Other"},
+		{"matched used pid", PDQQuery{NHS_ID: "9999999468", Used_PID: "9999999468", Used_PID_OID: tukcnst.NHS_OID_DEFAULT}, []TUKPatient{other, searched}, "9999999468", "R1", "", "Searched"},
+		{"merged patient skipped", PDQQuery{}, []TUKPatient{{NHSID: "9434765919", Status: HL7V3_STATUS_OBSOLETE, FamilyName: "Old"}, searched}, "9999999468", "R1", "", "Searched"},
+		{"inactive patient only", PDQQuery{}, []TUKPatient{{NHSID: "9434765919", Inactive: true, FamilyName: "Old"}}, "", "", "", ""},
+		{"unresolved candidates", PDQQuery{NHS_ID: "9999999468", Used_PID: "9999999468", Used_PID_OID: "1.2.3"}, []TUKPatient{other, searched}, "9999999468", "", "", ""},
+	}
+	for _, tt := range tests {
+		q := tt.query
+		q.Patients = &tt.patients
+		q.setQueryPatient()
+		if q.NHS_ID != tt.nhs || q.REG_ID != tt.reg || q.MRN_ID != tt.mrn || q.FamilyName != tt.family {
+			t.Errorf("%s: query = %s %s %s %s, want %s %s %s %s", tt.name, q.NHS_ID, q.REG_ID, q.MRN_ID, q.FamilyName, tt.nhs, tt.reg, tt.mrn, tt.family)
+		}
+	}
+}
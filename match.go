@@ -0,0 +1,303 @@
+package tukpdq
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+const (
+	MATCH_SORT_DESCENDING = "desc"
+	MATCH_SORT_ASCENDING  = "asc"
+	MATCH_RESULT_MATCH    = "match"
+	MATCH_RESULT_POSSIBLE = "possible match"
+	MATCH_RESULT_NONE     = "non-match"
+)
+
+// Match_Config sets the demographic weights and match thresholds, out of 100. Unset values are taken from Default_Match_Config
+type Match_Config struct {
+	Given_Weight       float64 `json:",omitempty"`
+	Family_Weight      float64 `json:",omitempty"`
+	BirthDate_Weight   float64 `json:",omitempty"`
+	Gender_Weight      float64 `json:",omitempty"`
+	Postcode_Weight    float64 `json:",omitempty"`
+	Match_Threshold    float64 `json:",omitempty"`
+	Possible_Threshold float64 `json:",omitempty"`
+}
+
+// MatchResult is the match score and classification of a candidate patient
+type MatchResult struct {
+	Score          float64            `json:"score"`
+	Classification string             `json:"classification"`
+	Agreement      map[string]float64 `json:"agreement,omitempty"`
+}
+
+var Default_Match_Config = Match_Config{
+	Given_Weight:       20,
+	Family_Weight:      30,
+	BirthDate_Weight:   30,
+	Gender_Weight:      5,
+	Postcode_Weight:    15,
+	Match_Threshold:    85,
+	Possible_Threshold: 60,
+}
+
+// Score_Patient scores the candidate patient against the demographics of the query patient
+func Score_Patient(query TUKPatient, candidate TUKPatient, cfg Match_Config) MatchResult {
+	cfg = cfg.withDefaults()
+	result := MatchResult{Agreement: make(map[string]float64)}
+	total, weights := 0.0, 0.0
+	compare := func(field string, weight float64, agreement float64) {
+		result.Agreement[field] = agreement
+		total = total + weight*agreement
+		weights = weights + weight
+	}
+	if given := patientGivenNames(query); len(given) > 0 {
+		if candidates := patientGivenNames(candidate); len(candidates) > 0 {
+			compare("given", cfg.Given_Weight, bestNameAgreement(given, candidates))
+		}
+	}
+	if family := patientFamilyNames(query); len(family) > 0 {
+		if candidates := patientFamilyNames(candidate); len(candidates) > 0 {
+			compare("family", cfg.Family_Weight, bestNameAgreement(family, candidates))
+		}
+	}
+	if query.BirthDate != "" && candidate.BirthDate != "" {
+		compare("birthdate", cfg.BirthDate_Weight, birthDateAgreement(query.BirthDate, candidate.BirthDate))
+	}
+	if qg, cg := normalisedGender(query.Gender), normalisedGender(candidate.Gender); qg != "" && cg != "" {
+		agreement := 0.0
+		if qg == cg {
+			agreement = 1
+		}
+		compare("gender", cfg.Gender_Weight, agreement)
+	}
+	if query.Zip != "" && candidate.Zip != "" {
+		compare("postcode", cfg.Postcode_Weight, postcodeAgreement(query.Zip, candidate.Zip))
+	}
+	if weights > 0 {
+		result.Score = total / weights * 100
+	}
+	switch {
+	case weights > 0 && result.Score >= cfg.Match_Threshold:
+		result.Classification = MATCH_RESULT_MATCH
+	case weights > 0 && result.Score >= cfg.Possible_Threshold:
+		result.Classification = MATCH_RESULT_POSSIBLE
+	default:
+		result.Classification = MATCH_RESULT_NONE
+	}
+	return result
+}
+
+// withDefaults returns the config with any weight or threshold that is not set taken from Default_Match_Config
+func (c Match_Config) withDefaults() Match_Config {
+	c.Given_Weight = defaultWeight(c.Given_Weight, Default_Match_Config.Given_Weight)
+	c.Family_Weight = defaultWeight(c.Family_Weight, Default_Match_Config.Family_Weight)
+	c.BirthDate_Weight = defaultWeight(c.BirthDate_Weight, Default_Match_Config.BirthDate_Weight)
+	c.Gender_Weight = defaultWeight(c.Gender_Weight, Default_Match_Config.Gender_Weight)
+	c.Postcode_Weight = defaultWeight(c.Postcode_Weight, Default_Match_Config.Postcode_Weight)
+	c.Match_Threshold = defaultWeight(c.Match_Threshold, Default_Match_Config.Match_Threshold)
+	c.Possible_Threshold = defaultWeight(c.Possible_Threshold, Default_Match_Config.Possible_Threshold)
+	return c
+}
+func defaultWeight(v float64, def float64) float64 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// Name_Agreement returns the agreement of two names from 0 to 1
+func Name_Agreement(a string, b string) float64 {
+	a, b = phoneticInput(a), phoneticInput(b)
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	jw := Jaro_Winkler(a, b)
+	if phoneticMatch(a, b) && jw < 0.85 {
+		return 0.85
+	}
+	if jw < 0.7 {
+		return 0
+	}
+	return jw
+}
+func phoneticMatch(a string, b string) bool {
+	if Soundex(a) == Soundex(b) {
+		return true
+	}
+	ap, aa := Double_Metaphone(a)
+	bp, ba := Double_Metaphone(b)
+	return ap == bp || ap == ba || aa == bp || aa == ba
+}
+func bestNameAgreement(names []string, candidates []string) float64 {
+	best := 0.0
+	for _, n := range names {
+		for _, c := range candidates {
+			if agreement := Name_Agreement(n, c); agreement > best {
+				best = agreement
+			}
+		}
+	}
+	return best
+}
+func patientGivenNames(p TUKPatient) []string {
+	var names []string
+	for _, n := range p.Names {
+		if n.Use != "old" && len(n.Given) > 0 {
+			names = append(names, n.Given[0])
+		}
+	}
+	if given := strings.Fields(p.GivenName); len(given) > 0 {
+		names = append(names, given[0])
+	}
+	return names
+}
+func patientFamilyNames(p TUKPatient) []string {
+	var names []string
+	for _, n := range p.Names {
+		if n.Family != "" {
+			names = append(names, n.Family)
+		}
+	}
+	if p.FamilyName != "" {
+		names = append(names, p.FamilyName)
+	}
+	return names
+}
+
+// birthDateAgreement compares two dates of birth allowing for transposed or mistyped digits
+func birthDateAgreement(a string, b string) float64 {
+	a, b = strings.ReplaceAll(a, "-", ""), strings.ReplaceAll(b, "-", "")
+	if len(a) > 8 {
+		a = a[:8]
+	}
+	if len(b) > 8 {
+		b = b[:8]
+	}
+	switch {
+	case a == b:
+		return 1
+	case len(a) != 8 || len(b) != 8:
+		if strings.HasPrefix(a, b) || strings.HasPrefix(b, a) {
+			return 0.6
+		}
+		return 0
+	case a[:4] == b[:4] && a[4:6] == b[6:8] && a[6:8] == b[4:6]:
+		return 0.8
+	}
+	diffs := []int{}
+	for n := 0; n < 8; n++ {
+		if a[n] != b[n] {
+			diffs = append(diffs, n)
+		}
+	}
+	switch {
+	case len(diffs) == 2 && diffs[1] == diffs[0]+1 && a[diffs[0]] == b[diffs[1]] && a[diffs[1]] == b[diffs[0]]:
+		return 0.7
+	case len(diffs) == 1:
+		return 0.5
+	case a[:6] == b[:6]:
+		return 0.3
+	}
+	return 0
+}
+func normalisedGender(gender string) string {
+	switch g := strings.ToLower(gender); g {
+	case "m", "male":
+		return "male"
+	case "f", "female":
+		return "female"
+	case "o", "other", "un":
+		return "other"
+	}
+	return ""
+}
+func normalisedPostcode(postcode string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(postcode), " ", ""))
+}
+
+// postcodeAgreement returns 1 for the same postcode and 0.6 if the outward codes are the same
+func postcodeAgreement(a string, b string) float64 {
+	a, b = normalisedPostcode(a), normalisedPostcode(b)
+	switch {
+	case a == b:
+		return 1
+	case len(a) > 3 && len(b) > 3 && a[:len(a)-3] == b[:len(b)-3]:
+		return 0.6
+	}
+	return 0
+}
+
+// queryPatient returns the query demographics as a TUKPatient
+func (i *PDQQuery) queryPatient() TUKPatient {
+	return TUKPatient{
+		GivenName:  i.GivenName,
+		FamilyName: i.FamilyName,
+		BirthDate:  i.BirthDate,
+		Gender:     i.Gender,
+		Zip:        i.Zip,
+	}
+}
+
+// scorePatients sets the client side match result of each patient if Match_Config is set and the query has demographics to compare
+func (i *PDQQuery) scorePatients() {
+	if i.Match_Config == nil || i.Patients == nil {
+		return
+	}
+	if i.GivenName == "" && i.FamilyName == "" && i.BirthDate == "" && i.Gender == "" && i.Zip == "" {
+		return
+	}
+	query := i.queryPatient()
+	for n := range *i.Patients {
+		result := Score_Patient(query, (*i.Patients)[n], *i.Match_Config)
+		(*i.Patients)[n].Match = &result
+	}
+}
+
+// scored returns true if the patient has a client side match score or a supplier match score
+func (p TUKPatient) scored() bool {
+	return p.Match != nil || p.MatchScore > 0
+}
+
+// score returns the client side match score if the patient has been scored, otherwise the supplier match score
+func (p TUKPatient) score() float64 {
+	if p.Match != nil {
+		return p.Match.Score
+	}
+	return p.MatchScore
+}
+
+// rankPatients scores, filters and sorts the query patients
+func (i *PDQQuery) rankPatients() bool {
+	if i.Patients == nil {
+		return false
+	}
+	i.scorePatients()
+	if i.Min_Match_Score > 0 {
+		matched := []TUKPatient{}
+		for _, pat := range *i.Patients {
+			if !pat.scored() || pat.score() >= i.Min_Match_Score {
+				matched = append(matched, pat)
+			}
+		}
+		if len(matched) < len(*i.Patients) {
+			issue := fmt.Sprintf("removed %v patients with a match score below %v", len(*i.Patients)-len(matched), i.Min_Match_Score)
+			log.Println(issue)
+			i.Issues = append(i.Issues, issue)
+		}
+		*i.Patients = matched
+	}
+	switch i.Match_Sort_Order {
+	case MATCH_SORT_DESCENDING:
+		sort.SliceStable(*i.Patients, func(x, y int) bool { return (*i.Patients)[x].score() > (*i.Patients)[y].score() })
+	case MATCH_SORT_ASCENDING:
+		sort.SliceStable(*i.Patients, func(x, y int) bool { return (*i.Patients)[x].score() < (*i.Patients)[y].score() })
+	}
+	i.Count = len(*i.Patients)
+	return i.Count > 0
+}
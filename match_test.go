@@ -0,0 +1,92 @@
+package tukpdq
+
+import "testing"
+
+func TestRankPatients(t *testing.T) {
+	tests := []struct {
+		name     string
+		patients []TUKPatient
+		want     []string
+		issues   int
+	}{
+		{"unscored patients kept", []TUKPatient{{NHSID: "1"}, {NHSID: "2"}}, []string{"1", "2"}, 0},
+		{"low scores removed", []TUKPatient{{NHSID: "1", MatchScore: 40}, {NHSID: "2", MatchScore: 90}, {NHSID: "3", MatchScore: 70}}, []string{"2", "3"}, 1},
+		{"client side score", []TUKPatient{{NHSID: "1", MatchScore: 90, Match: &MatchResult{Score: 20}}}, []string{}, 1},
+	}
+	for _, tt := range tests {
+		i := PDQQuery{Min_Match_Score: 50, Match_Sort_Order: MATCH_SORT_DESCENDING, Patients: &tt.patients}
+		i.rankPatients()
+		got := []string{}
+		for _, pat := range *i.Patients {
+			got = append(got, pat.NHSID)
+		}
+		if len(got) != len(tt.want) || i.Count != len(tt.want) || len(i.Issues) != tt.issues {
+			t.Errorf("%s: patients = %v, count = %v, issues = %v, want %v with %v issues", tt.name, got, i.Count, i.Issues, tt.want, tt.issues)
+			continue
+		}
+		for n := range got {
+			if got[n] != tt.want[n] {
+				t.Errorf("%s: patients = %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestScorePatient(t *testing.T) {
+	query := TUKPatient{GivenName: "Fred", FamilyName: "Bloggs", BirthDate: "1970-01-02", Gender: "M", Zip: "LS1 4AP"}
+	tests := []struct {
+		name      string
+		candidate TUKPatient
+		cfg       Match_Config
+		score     float64
+		want      string
+	}{
+		{"exact", TUKPatient{GivenName: "FRED", FamilyName: "bloggs", BirthDate: "19700102", Gender: "male", Zip: "ls14ap"}, Default_Match_Config, 100, MATCH_RESULT_MATCH},
+		{"day and month transposed", TUKPatient{GivenName: "Fred", FamilyName: "Bloggs", BirthDate: "1970-02-01", Gender: "male", Zip: "LS1 4AP"}, Default_Match_Config, 94, MATCH_RESULT_MATCH},
+		{"possible", TUKPatient{GivenName: "John", FamilyName: "Bloggs", BirthDate: "1970-01-02", Gender: "male", Zip: "M1 1AA"}, Default_Match_Config, 65, MATCH_RESULT_POSSIBLE},
+		{"partial config", TUKPatient{GivenName: "John", FamilyName: "Bloggs", BirthDate: "1970-01-02", Gender: "male", Zip: "M1 1AA"}, Match_Config{Match_Threshold: 60}, 65, MATCH_RESULT_MATCH},
+		{"empty config", TUKPatient{GivenName: "Fred", FamilyName: "Bloggs"}, Match_Config{}, 100, MATCH_RESULT_MATCH},
+		{"non-match", TUKPatient{GivenName: "John", FamilyName: "Jones", BirthDate: "1985-06-07", Gender: "female", Zip: "M1 1AA"}, Default_Match_Config, 0, MATCH_RESULT_NONE},
+		{"nothing to compare", TUKPatient{NHSID: "9434765919"}, Default_Match_Config, 0, MATCH_RESULT_NONE},
+	}
+	for _, tt := range tests {
+		got := Score_Patient(query, tt.candidate, tt.cfg)
+		if got.Score < tt.score-0.01 || got.Score > tt.score+0.01 || got.Classification != tt.want {
+			t.Errorf("%s: Score_Patient() = %v %q, want %v %q, agreement %v", tt.name, got.Score, got.Classification, tt.score, tt.want, got.Agreement)
+		}
+	}
+}
+
+func TestNameAgreement(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		min, max float64
+	}{
+		{"Smith", "SMITH", 1, 1},
+		{"O'Brien", "obrien", 1, 1},
+		{"Smith", "Smyth", 0.85, 1},
+		{"Catherine", "Kathryn", 0.85, 1},
+		{"Jonathan", "Jonathon", 0.9, 1},
+		{"Smith", "Jones", 0, 0},
+		{"Smith", "", 0, 0},
+	}
+	for _, tt := range tests {
+		if got := Name_Agreement(tt.a, tt.b); got < tt.min || got > tt.max {
+			t.Errorf("Name_Agreement(%q, %q) = %v, want %v to %v", tt.a, tt.b, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestRankPatientsIDOnlyQuery(t *testing.T) {
+	patients := []TUKPatient{{NHSID: "1", FamilyName: "Bloggs"}, {NHSID: "2", FamilyName: "Jones"}}
+	i := PDQQuery{NHS_ID: "9434765919", Match_Config: &Match_Config{}, Min_Match_Score: 50, Patients: &patients}
+	if !i.rankPatients() || i.Count != 2 || len(i.Issues) != 0 {
+		t.Errorf("rankPatients() count = %v, issues = %v, want both patients kept", i.Count, i.Issues)
+	}
+	for _, pat := range *i.Patients {
+		if pat.Match != nil {
+			t.Errorf("patient %s match = %+v, want unscored", pat.NHSID, pat.Match)
+		}
+	}
+}
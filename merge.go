@@ -0,0 +1,105 @@
+package tukpdq
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ipthomas/tukcnst"
+	"github.com/ipthomas/tukhttp"
+)
+
+const (
+	FHIR_RESOURCE_PATIENT  = "Patient"
+	FHIR_LINK_REPLACED_BY  = "replaced-by"
+	FHIR_LINK_REPLACES     = "replaces"
+	HL7V3_STATUS_NULLIFIED = "nullified"
+	HL7V3_STATUS_OBSOLETE  = "obsolete"
+	MAX_REPLACED_BY_LINKS  = 5
+)
+
+// Is_Merged returns true if the patient record has been replaced by another record
+func (p *TUKPatient) Is_Merged() bool {
+	return len(p.ReplacedBy) > 0 || p.Status == HL7V3_STATUS_OBSOLETE
+}
+
+// isCurrent returns true if the patient record is active and has not been merged into another record
+func (p *TUKPatient) isCurrent() bool {
+	return !p.Inactive && !p.Is_Merged()
+}
+
+// checkStatus logs and records an issue if the patient record is inactive or has been merged
+func (p *TUKPatient) checkStatus() {
+	issue := ""
+	switch {
+	case len(p.ReplacedBy) > 0:
+		issue = "patient " + p.Reference + " has been replaced by " + strings.Join(p.ReplacedBy, ", ")
+	case p.Status == HL7V3_STATUS_OBSOLETE || p.Status == HL7V3_STATUS_NULLIFIED:
+		issue = "patient status is " + p.Status
+	case p.Inactive:
+		issue = "patient " + p.Reference + " is not active"
+	}
+	if issue != "" {
+		log.Println(issue)
+		p.Issues = append(p.Issues, issue)
+	}
+}
+
+// followReplacedBy returns the surviving patient of a merged PIXm patient
+func (i *PDQQuery) followReplacedBy(pat TUKPatient) TUKPatient {
+	seen := map[string]bool{pat.Reference: true}
+	for n := 0; n < MAX_REPLACED_BY_LINKS && len(pat.ReplacedBy) > 0; n++ {
+		ref := pat.ReplacedBy[0]
+		if seen[ref] {
+			pat.Issues = append(pat.Issues, "replaced-by link "+ref+" loops back to a merged patient")
+			return pat
+		}
+		seen[ref] = true
+		log.Printf("Following replaced-by link from %s to %s", pat.Reference, ref)
+		survivor, err := i.getPIXmPatient(ref)
+		if err != nil {
+			log.Println(err.Error())
+			pat.Issues = append(pat.Issues, "unable to follow replaced-by link "+ref+" - "+err.Error())
+			return pat
+		}
+		if !contains(survivor.Replaces, pat.Reference) {
+			survivor.Replaces = append(survivor.Replaces, pat.Reference)
+		}
+		pat = survivor
+	}
+	return pat
+}
+
+// getPIXmPatient reads the patient resource with the reference. Relative references are resolved against the pdq server url
+func (i *PDQQuery) getPIXmPatient(ref string) (TUKPatient, error) {
+	httpReq := tukhttp.HTTPRequest{
+		Server:  tukcnst.PDQ_SERVER_TYPE_IHE_PIXM,
+		Method:  http.MethodGet,
+		URL:     i.resolveReference(ref),
+		Timeout: i.Timeout,
+	}
+	if err := i.newHTTPRequest(&httpReq); err != nil {
+		return TUKPatient{}, err
+	}
+	if _, err := newOutcomeError(httpReq.StatusCode, httpReq.Response); err != nil {
+		return TUKPatient{}, err
+	}
+	rsp := PIXmResource{}
+	if err := json.Unmarshal(httpReq.Response, &rsp); err != nil {
+		return TUKPatient{}, err
+	}
+	if rsp.ResourceType != FHIR_RESOURCE_PATIENT {
+		return TUKPatient{}, errors.New("invalid response - expected a Patient resource, received " + rsp.ResourceType)
+	}
+	return i.newPIXmPatient(rsp), nil
+}
+func (i *PDQQuery) resolveReference(ref string) string {
+	if strings.Contains(ref, "://") {
+		return ref
+	}
+	base := strings.TrimSuffix(strings.Split(i.Server_URL, "?")[0], "/")
+	base = strings.TrimSuffix(base, "/"+FHIR_RESOURCE_PATIENT)
+	return base + "/" + strings.TrimPrefix(ref, "/")
+}
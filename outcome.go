@@ -0,0 +1,144 @@
+package tukpdq
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	OUTCOME_SOURCE_IDENTIFIER_NOT_FOUND = "source-identifier-not-found"
+	OUTCOME_SOURCE_DOMAIN_NOT_FOUND     = "source-domain-not-found"
+	OUTCOME_TARGET_SYSTEM_NOT_FOUND     = "target-system-not-found"
+	OUTCOME_SERVER_ERROR                = "server-error"
+	OUTCOME_INVALID_RESPONSE            = "invalid-response"
+	FHIR_RESOURCE_OPERATION_OUTCOME     = "OperationOutcome"
+)
+
+type OperationOutcome struct {
+	ResourceType string                  `json:"resourceType"`
+	ID           string                  `json:"id,omitempty"`
+	Issue        []OperationOutcomeIssue `json:"issue"`
+}
+type OperationOutcomeIssue struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Details  *struct {
+		Coding []struct {
+			System  string `json:"system,omitempty"`
+			Code    string `json:"code,omitempty"`
+			Display string `json:"display,omitempty"`
+		} `json:"coding,omitempty"`
+		Text string `json:"text,omitempty"`
+	} `json:"details,omitempty"`
+	Diagnostics string   `json:"diagnostics,omitempty"`
+	Expression  []string `json:"expression,omitempty"`
+	Location    []string `json:"location,omitempty"`
+}
+
+// OutcomeError is returned for a FHIR OperationOutcome error or an error status code
+type OutcomeError struct {
+	StatusCode int
+	Outcome    string
+	Issues     []OperationOutcomeIssue
+}
+
+func (e *OutcomeError) Error() string {
+	msg := "pdq server returned " + e.Outcome + " - status code " + strconv.Itoa(e.StatusCode)
+	for _, issue := range e.Issues {
+		msg = msg + " - " + issue.Severity + " " + issue.Code
+		if issue.Diagnostics != "" {
+			msg = msg + " " + issue.Diagnostics
+		}
+		if len(issue.Expression) > 0 {
+			msg = msg + " (" + strings.Join(issue.Expression, ", ") + ")"
+		}
+	}
+	return msg
+}
+
+// HasErrors returns true if any issue in the outcome has a severity of error or fatal
+func (o *OperationOutcome) HasErrors() bool {
+	for _, issue := range o.Issue {
+		if issue.Severity == "error" || issue.Severity == "fatal" {
+			return true
+		}
+	}
+	return false
+}
+
+// newOutcomeError returns the OperationOutcome of a FHIR response and an *OutcomeError if it reports an error
+func newOutcomeError(statusCode int, response []byte) (*OperationOutcome, error) {
+	var outcome *OperationOutcome
+	var rsc struct {
+		ResourceType string `json:"resourceType"`
+	}
+	if json.Unmarshal(response, &rsc) == nil && rsc.ResourceType == FHIR_RESOURCE_OPERATION_OUTCOME {
+		outcome = &OperationOutcome{}
+		if err := json.Unmarshal(response, outcome); err != nil {
+			return nil, &OutcomeError{StatusCode: statusCode, Outcome: OUTCOME_INVALID_RESPONSE, Issues: []OperationOutcomeIssue{{Severity: "error", Code: "structure", Diagnostics: err.Error()}}}
+		}
+	}
+	isOK := statusCode >= http.StatusOK && statusCode < http.StatusMultipleChoices
+	if isOK && (outcome == nil || !outcome.HasErrors()) {
+		return outcome, nil
+	}
+	if outcome == nil {
+		outcome = &OperationOutcome{
+			ResourceType: FHIR_RESOURCE_OPERATION_OUTCOME,
+			Issue:        []OperationOutcomeIssue{{Severity: "error", Code: "exception", Diagnostics: http.StatusText(statusCode)}},
+		}
+	}
+	return outcome, &OutcomeError{StatusCode: statusCode, Outcome: outcome.outcomeCode(statusCode), Issues: outcome.Issue}
+}
+
+// outcomeCode maps the outcome to an ITI-83 error case
+func (o *OperationOutcome) outcomeCode(statusCode int) string {
+	for _, issue := range o.Issue {
+		diag := strings.ToLower(issue.Diagnostics)
+		switch {
+		case strings.Contains(diag, "targetsystem") || strings.Contains(diag, "target system"):
+			return OUTCOME_TARGET_SYSTEM_NOT_FOUND
+		case strings.Contains(diag, "assigning authority"):
+			return OUTCOME_SOURCE_DOMAIN_NOT_FOUND
+		case strings.Contains(diag, "sourceidentifier") || strings.Contains(diag, "source identifier"):
+			return OUTCOME_SOURCE_IDENTIFIER_NOT_FOUND
+		}
+	}
+	switch statusCode {
+	case http.StatusNotFound:
+		return OUTCOME_SOURCE_IDENTIFIER_NOT_FOUND
+	case http.StatusForbidden:
+		return OUTCOME_TARGET_SYSTEM_NOT_FOUND
+	case http.StatusBadRequest:
+		for _, issue := range o.Issue {
+			if issue.Code == "code-invalid" {
+				return OUTCOME_SOURCE_DOMAIN_NOT_FOUND
+			}
+		}
+	}
+	for _, issue := range o.Issue {
+		if issue.Code == "not-found" {
+			return OUTCOME_SOURCE_IDENTIFIER_NOT_FOUND
+		}
+	}
+	return OUTCOME_SERVER_ERROR
+}
+
+// outcome returns the merged OperationOutcome entries of a search set bundle
+func (b *PIXmResponse) outcome(statusCode int) (*OperationOutcome, error) {
+	var outcome *OperationOutcome
+	for _, entry := range b.Entry {
+		if entry.Resource.ResourceType == FHIR_RESOURCE_OPERATION_OUTCOME {
+			if outcome == nil {
+				outcome = &OperationOutcome{ResourceType: FHIR_RESOURCE_OPERATION_OUTCOME, ID: entry.Resource.ID}
+			}
+			outcome.Issue = append(outcome.Issue, entry.Resource.Issue...)
+		}
+	}
+	if outcome != nil && outcome.HasErrors() {
+		return outcome, &OutcomeError{StatusCode: statusCode, Outcome: outcome.outcomeCode(statusCode), Issues: outcome.Issue}
+	}
+	return outcome, nil
+}
@@ -0,0 +1,86 @@
+package tukpdq
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func outcomeBody(code string, diagnostics string) string {
+	return `{"resourceType":"OperationOutcome","issue":[{"severity":"error","code":"` + code + `","diagnostics":"` + diagnostics + `"}]}`
+}
+
+func TestNewOutcomeError(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		outcome string
+	}{
+		{"ok bundle", http.StatusOK, `{"resourceType":"Bundle","total":0}`, ""},
+		{"warnings only", http.StatusOK, `{"resourceType":"OperationOutcome","issue":[{"severity":"warning","code":"informational","diagnostics":"Error in address"}]}`, ""},
+		{"source identifier diagnostics", http.StatusBadRequest, outcomeBody("code-invalid", "sourceIdentifier Patient Identifier not found"), OUTCOME_SOURCE_IDENTIFIER_NOT_FOUND},
+		{"assigning authority diagnostics", http.StatusNotFound, outcomeBody("not-found", "sourceIdentifier Assigning Authority not found"), OUTCOME_SOURCE_DOMAIN_NOT_FOUND},
+		{"target system diagnostics", http.StatusBadRequest, outcomeBody("code-invalid", "targetSystem not found"), OUTCOME_TARGET_SYSTEM_NOT_FOUND},
+		{"404", http.StatusNotFound, outcomeBody("processing", ""), OUTCOME_SOURCE_IDENTIFIER_NOT_FOUND},
+		{"403", http.StatusForbidden, outcomeBody("code-invalid", ""), OUTCOME_TARGET_SYSTEM_NOT_FOUND},
+		{"400 code-invalid", http.StatusBadRequest, outcomeBody("code-invalid", ""), OUTCOME_SOURCE_DOMAIN_NOT_FOUND},
+		{"200 not-found issue", http.StatusOK, outcomeBody("not-found", ""), OUTCOME_SOURCE_IDENTIFIER_NOT_FOUND},
+		{"500 outcome", http.StatusInternalServerError, outcomeBody("exception", "database unavailable"), OUTCOME_SERVER_ERROR},
+		{"non json error body", http.StatusBadGateway, "<html>Bad Gateway</html>", OUTCOME_SERVER_ERROR},
+		{"invalid outcome", http.StatusOK, `{"resourceType":"OperationOutcome","issue":"broken"}`, OUTCOME_INVALID_RESPONSE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outcome, err := newOutcomeError(tt.status, []byte(tt.body))
+			if tt.outcome == "" {
+				if err != nil {
+					t.Fatalf("newOutcomeError() error = %v, want nil", err)
+				}
+				return
+			}
+			var oerr *OutcomeError
+			if !errors.As(err, &oerr) {
+				t.Fatalf("newOutcomeError() error = %v, want an OutcomeError", err)
+			}
+			if oerr.Outcome != tt.outcome || oerr.StatusCode != tt.status || len(oerr.Issues) == 0 {
+				t.Errorf("newOutcomeError() = %+v, want outcome %s", oerr, tt.outcome)
+			}
+			if tt.outcome != OUTCOME_INVALID_RESPONSE && outcome == nil {
+				t.Error("newOutcomeError() outcome = nil")
+			}
+		})
+	}
+}
+
+func TestPDQmSearch(t *testing.T) {
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		if query.Get("family") == "Unknown" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, outcomeBody("not-found", ""))
+			return
+		}
+		fmt.Fprint(w, `{"resourceType":"Bundle","total":1,"entry":[{"resource":{"resourceType":"Patient","id":"7","identifier":[{"system":"urn:oid:2.16.840.1.113883.2.1.4.1","value":"9999999468"}],"name":[{"family":"Bloggs","given":["Fred"]}]}}]}`)
+	}))
+	defer srv.Close()
+	i := PDQQuery{Server_Mode: PDQ_SERVER_TYPE_IHE_PDQM, Server_URL: srv.URL, REG_OID: "2.16.840.1.113883.2.1.3.31.2.1.1", FamilyName: "Bloggs", BirthDate: "19800102", Gender: "M", HTTPClient: http.DefaultClient}
+	if err := New_Transaction(&i); err != nil {
+		t.Fatalf("New_Transaction() error = %v", err)
+	}
+	if query.Get("family") != "Bloggs" || query.Get("birthdate") != "1980-01-02" || query.Get("gender") != "male" || query.Get("identifier") != "" {
+		t.Errorf("search parameters = %v", query)
+	}
+	if i.Count != 1 || i.NHS_ID != "9999999468" {
+		t.Errorf("Count = %v, NHS_ID = %q, want 1 and 9999999468", i.Count, i.NHS_ID)
+	}
+	i = PDQQuery{Server_Mode: PDQ_SERVER_TYPE_IHE_PDQM, Server_URL: srv.URL, REG_OID: "2.16.840.1.113883.2.1.3.31.2.1.1", FamilyName: "Unknown", HTTPClient: http.DefaultClient}
+	var oerr *OutcomeError
+	if err := New_Transaction(&i); !errors.As(err, &oerr) || oerr.Outcome != OUTCOME_SOURCE_IDENTIFIER_NOT_FOUND {
+		t.Errorf("New_Transaction() error = %v, want source identifier not found", err)
+	}
+}
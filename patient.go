@@ -0,0 +1,235 @@
+package tukpdq
+
+import (
+	"strings"
+	"time"
+)
+
+// Period is the FHIR date or dateTime range during which a name, address or telecom is or was in use. An empty Start or End is open
+type Period struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+// HumanName is a patient name. Use is the FHIR name use, usual, official, temp, nickname, anonymous, old or maiden
+type HumanName struct {
+	Use    string   `json:"use,omitempty"`
+	Prefix []string `json:"prefix,omitempty"`
+	Given  []string `json:"given,omitempty"`
+	Family string   `json:"family,omitempty"`
+	Suffix []string `json:"suffix,omitempty"`
+	Period *Period  `json:"period,omitempty"`
+}
+
+// Address is a patient address. Use is the FHIR address use, home, work, temp, old or billing and Type is postal, physical or both
+type Address struct {
+	Use        string   `json:"use,omitempty"`
+	Type       string   `json:"type,omitempty"`
+	Line       []string `json:"line,omitempty"`
+	City       string   `json:"city,omitempty"`
+	District   string   `json:"district,omitempty"`
+	State      string   `json:"state,omitempty"`
+	PostalCode string   `json:"postalCode,omitempty"`
+	Country    string   `json:"country,omitempty"`
+	Period     *Period  `json:"period,omitempty"`
+}
+
+// Telecom is a patient contact point. System is the FHIR contact point system, phone, fax, email or url
+type Telecom struct {
+	System string  `json:"system,omitempty"`
+	Use    string  `json:"use,omitempty"`
+	Value  string  `json:"value,omitempty"`
+	Period *Period `json:"period,omitempty"`
+}
+
+// Current returns true if the period has started and not ended
+func (p *Period) Current() bool {
+	if p == nil {
+		return true
+	}
+	now := time.Now().Format("2006-01-02")
+	start, end := periodDate(p.Start), periodDate(p.End)
+	return (start == "" || start <= now[:len(start)]) && (end == "" || end >= now[:len(end)])
+}
+
+// periodDate returns the YYYY, YYYY-MM or YYYY-MM-DD date part of a FHIR date or dateTime
+func periodDate(date string) string {
+	if len(date) > 10 {
+		return date[:10]
+	}
+	return date
+}
+
+// Usual_Name returns the current usual name of the patient, or the official name if there is no usual name
+func (p *TUKPatient) Usual_Name() HumanName {
+	for _, use := range []string{"usual", "official", ""} {
+		for _, n := range p.Names {
+			if n.Use == use && n.Period.Current() {
+				return n
+			}
+		}
+	}
+	for _, n := range p.Names {
+		if n.Use != "old" && n.Use != "maiden" && n.Period.Current() {
+			return n
+		}
+	}
+	return HumanName{}
+}
+
+// Home_Address returns the current home address of the patient
+func (p *TUKPatient) Home_Address() Address {
+	for _, use := range []string{"home", ""} {
+		for _, a := range p.Addresses {
+			if a.Use == use && a.Type != "postal" && a.Period.Current() {
+				return a
+			}
+		}
+	}
+	for _, a := range p.Addresses {
+		if a.Use != "old" && a.Period.Current() {
+			return a
+		}
+	}
+	return Address{}
+}
+
+// setFlatFields sets the GivenName, FamilyName and address fields from the usual name and home address
+func (p *TUKPatient) setFlatFields() {
+	if len(p.Names) > 0 {
+		name := p.Usual_Name()
+		p.GivenName = strings.Join(name.Given, " ")
+		p.FamilyName = name.Family
+	}
+	if len(p.Addresses) > 0 {
+		addr := p.Home_Address()
+		p.Street, p.Town = "", ""
+		if len(addr.Line) > 0 {
+			p.Street = addr.Line[0]
+			if len(addr.Line) > 1 {
+				p.Town = addr.Line[1]
+			}
+		}
+		p.City = addr.City
+		p.State = addr.State
+		p.Zip = addr.PostalCode
+		p.Country = addr.Country
+	}
+}
+
+// newHL7V3Telecom returns the Telecom for an HL7v3 TEL value url, tel:, fax:, mailto: or http(s):, and use code
+func newHL7V3Telecom(value string, use string) Telecom {
+	t := Telecom{Value: value, Use: hl7v3TelecomUse(use)}
+	if scheme, v, ok := strings.Cut(value, ":"); ok {
+		switch strings.ToLower(scheme) {
+		case "tel":
+			t.System, t.Value = "phone", v
+		case "fax":
+			t.System, t.Value = "fax", v
+		case "mailto":
+			t.System, t.Value = "email", v
+		case "http", "https":
+			t.System = "url"
+		}
+	}
+	return t
+}
+
+// hl7v3TelecomUse returns the FHIR contact point use for an HL7v3 TelecommunicationAddressUse code
+func hl7v3TelecomUse(use string) string {
+	codes := strings.Fields(use)
+	if len(codes) == 0 {
+		return ""
+	}
+	switch codes[0] {
+	case "H", "HP", "HV":
+		return "home"
+	case "WP", "DIR", "PUB":
+		return "work"
+	case "MC", "PG":
+		return "mobile"
+	case "TMP":
+		return "temp"
+	}
+	return ""
+}
+
+// hl7v3NameUse returns the FHIR name use for an HL7v3 EntityNameUse code, or "" if the code has no FHIR equivalent
+func hl7v3NameUse(use string) string {
+	codes := strings.Fields(use)
+	if len(codes) == 0 {
+		return ""
+	}
+	switch codes[0] {
+	case "L", "OR":
+		return "official"
+	case "A", "P":
+		return "nickname"
+	case "ASGN", "C":
+		return "usual"
+	}
+	return ""
+}
+
+// hl7v3AddressUse returns the FHIR use and type for an HL7v3 PostalAddressUse code
+func hl7v3AddressUse(use string) (string, string) {
+	addrUse, addrType := "", ""
+	for _, code := range strings.Fields(use) {
+		switch code {
+		case "H", "HP", "HV":
+			addrUse = "home"
+		case "WP", "DIR", "PUB":
+			addrUse = "work"
+		case "TMP":
+			addrUse = "temp"
+		case "OLD", "BAD":
+			addrUse = "old"
+		case "PST":
+			addrType = "postal"
+		case "PHYS":
+			addrType = "physical"
+		}
+	}
+	return addrUse, addrType
+}
+
+// hl7v3Gender returns the FHIR gender for an HL7v3 AdministrativeGender code or null flavor
+func hl7v3Gender(code string, nullFlavor string) string {
+	switch code {
+	case "M":
+		return "male"
+	case "F":
+		return "female"
+	case "UN":
+		return "other"
+	case "", "UNK":
+		if code != "" || nullFlavor != "" {
+			return "unknown"
+		}
+	}
+	return code
+}
+
+// hl7v3DateTime returns the FHIR dateTime of an HL7v3 TS value
+func hl7v3DateTime(ts string) string {
+	if len(ts) < 8 {
+		return ts
+	}
+	dt := ts[:4] + "-" + ts[4:6] + "-" + ts[6:8]
+	if len(ts) >= 14 {
+		dt = dt + "T" + ts[8:10] + ":" + ts[10:12] + ":" + ts[12:14]
+		if zone := strings.IndexAny(ts[14:], "+-"); zone > -1 && len(ts[14+zone:]) == 5 {
+			zone = zone + 14
+			dt = dt + ts[zone:zone+3] + ":" + ts[zone+3:]
+		}
+	}
+	return dt
+}
+
+// hl7v3Date returns the YYYYMMDD date of an HL7v3 TS value
+func hl7v3Date(ts string) string {
+	if len(ts) > 8 {
+		return ts[:8]
+	}
+	return ts
+}
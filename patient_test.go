@@ -0,0 +1,180 @@
+package tukpdq
+
+import "testing"
+
+func TestHL7V3Gender(t *testing.T) {
+	tests := []struct {
+		code, nullFlavor, want string
+	}{
+		{"M", "", "male"},
+		{"F", "", "female"},
+		{"UN", "", "other"},
+		{"UNK", "", "unknown"},
+		{"", "UNK", "unknown"},
+		{"", "ASKU", "unknown"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		if got := hl7v3Gender(tt.code, tt.nullFlavor); got != tt.want {
+			t.Errorf("hl7v3Gender(%q, %q) = %q, want %q", tt.code, tt.nullFlavor, got, tt.want)
+		}
+		if got := fhirGender(tt.code); tt.code != "" && got != tt.want {
+			t.Errorf("fhirGender(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestCDAGender(t *testing.T) {
+	tests := []struct {
+		gender, want string
+	}{
+		{"male", "M"},
+		{"F", "F"},
+		{"other", "UN"},
+		{"UN", "UN"},
+		{"unknown", ""},
+		{"UNK", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := cdaGender(tt.gender); got != tt.want {
+			t.Errorf("cdaGender(%q) = %q, want %q", tt.gender, got, tt.want)
+		}
+	}
+	rt := (&TUKPatient{Gender: "unknown"}).CDA_Record_Target()
+	if code := rt.PatientRole.Patient.AdministrativeGenderCode; code.NullFlavor != HL7_NULL_FLAVOR_UNKNOWN || code.Code != "" {
+		t.Errorf("administrativeGenderCode = %+v, want the UNK null flavor", code)
+	}
+}
+
+func TestNewHL7V3Telecom(t *testing.T) {
+	tests := []struct {
+		value, use string
+		want       Telecom
+	}{
+		{"tel:+441134567890", "HP", Telecom{System: "phone", Use: "home", Value: "+441134567890"}},
+		{"mailto:fred.bloggs@example.nhs.uk", "WP DIR", Telecom{System: "email", Use: "work", Value: "fred.bloggs@example.nhs.uk"}},
+		{"tel:07700900123", "MC", Telecom{System: "phone", Use: "mobile", Value: "07700900123"}},
+		{"fax:01134567890", "AS", Telecom{System: "fax", Value: "01134567890"}},
+		{"https://example.nhs.uk", "EC", Telecom{System: "url", Value: "https://example.nhs.uk"}},
+		{"01134567890", "", Telecom{Value: "01134567890"}},
+	}
+	for _, tt := range tests {
+		if got := newHL7V3Telecom(tt.value, tt.use); got != tt.want {
+			t.Errorf("newHL7V3Telecom(%q, %q) = %+v, want %+v", tt.value, tt.use, got, tt.want)
+		}
+	}
+}
+
+func TestPeriodCurrent(t *testing.T) {
+	tests := []struct {
+		period *Period
+		want   bool
+	}{
+		{nil, true},
+		{&Period{}, true},
+		{&Period{Start: "2001-02-03"}, true},
+		{&Period{Start: "2001", End: "2999"}, true},
+		{&Period{End: "2999-01-01T00:00:00Z"}, true},
+		{&Period{Start: "2999-01"}, false},
+		{&Period{End: "2001-02-03"}, false},
+		{&Period{Start: "1990", End: "2001-02-03T10:00:00+01:00"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.period.Current(); got != tt.want {
+			t.Errorf("%+v Current() = %v, want %v", tt.period, got, tt.want)
+		}
+	}
+}
+
+func TestUsualName(t *testing.T) {
+	expired := &Period{End: "2001-02-03"}
+	tests := []struct {
+		name  string
+		names []HumanName
+		want  string
+	}{
+		{"usual before official", []HumanName{{Use: "official", Family: "Official"}, {Use: "usual", Family: "Usual"}}, "Usual"},
+		{"official before no use", []HumanName{{Family: "None"}, {Use: "official", Family: "Official"}}, "Official"},
+		{"no use before nickname", []HumanName{{Use: "nickname", Family: "Nickname"}, {Family: "None"}}, "None"},
+		{"expired usual", []HumanName{{Use: "usual", Family: "Expired", Period: expired}, {Use: "official", Family: "Official"}}, "Official"},
+		{"any current name", []HumanName{{Use: "old", Family: "Old"}, {Use: "maiden", Family: "Maiden"}, {Use: "temp", Family: "Temp"}}, "Temp"},
+		{"only old names", []HumanName{{Use: "old", Family: "Old"}, {Use: "maiden", Family: "Maiden"}}, ""},
+		{"no names", nil, ""},
+	}
+	for _, tt := range tests {
+		p := TUKPatient{Names: tt.names}
+		if got := p.Usual_Name(); got.Family != tt.want {
+			t.Errorf("%s: Usual_Name() = %+v, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHomeAddress(t *testing.T) {
+	expired := &Period{Start: "1990", End: "2001"}
+	tests := []struct {
+		name      string
+		addresses []Address
+		want      string
+	}{
+		{"home before no use", []Address{{PostalCode: "NONE"}, {Use: "home", PostalCode: "HOME"}}, "HOME"},
+		{"physical before postal", []Address{{Use: "home", Type: "postal", PostalCode: "POSTAL"}, {Use: "home", Type: "physical", PostalCode: "PHYSICAL"}}, "PHYSICAL"},
+		{"expired home", []Address{{Use: "home", PostalCode: "EXPIRED", Period: expired}, {PostalCode: "NONE"}}, "NONE"},
+		{"any current address", []Address{{Use: "old", PostalCode: "OLD"}, {Use: "home", Type: "postal", PostalCode: "POSTAL"}, {Use: "work", PostalCode: "WORK"}}, "POSTAL"},
+		{"only old addresses", []Address{{Use: "old", PostalCode: "OLD"}, {Use: "work", PostalCode: "EXPIRED", Period: expired}}, ""},
+	}
+	for _, tt := range tests {
+		p := TUKPatient{Addresses: tt.addresses}
+		if got := p.Home_Address(); got.PostalCode != tt.want {
+			t.Errorf("%s: Home_Address() = %+v, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSetFlatFields(t *testing.T) {
+	p := TUKPatient{
+		Names: []HumanName{
+			{Use: "usual", Given: []string{"Old"}, Family: "Name", Period: &Period{End: "2001"}},
+			{Use: "official", Given: []string{"Frederick", "John"}, Family: "Bloggs"},
+		},
+		Addresses: []Address{
+			{Use: "old", Line: []string{"1 Old Street"}, PostalCode: "LS1 1AA"},
+			{Use: "home", Line: []string{"2 New Street", "Headingley", "Ignored"}, City: "Leeds", State: "West Yorkshire", PostalCode: "LS6 2BB", Country: "GB"},
+		},
+		Street: "stale",
+		Town:   "stale",
+	}
+	p.setFlatFields()
+	if p.GivenName != "Frederick John" || p.FamilyName != "Bloggs" || p.Street != "2 New Street" || p.Town != "Headingley" || p.City != "Leeds" ||
+		p.State != "West Yorkshire" || p.Zip != "LS6 2BB" || p.Country != "GB" {
+		t.Errorf("setFlatFields() = %+v", p)
+	}
+	p.Addresses = []Address{{Use: "home", City: "York"}}
+	p.setFlatFields()
+	if p.Street != "" || p.Town != "" || p.City != "York" {
+		t.Errorf("setFlatFields() Street = %q, Town = %q, City = %q, want only City set", p.Street, p.Town, p.City)
+	}
+	p = TUKPatient{GivenName: "Fred", FamilyName: "Bloggs", Zip: "LS1 4AP"}
+	p.setFlatFields()
+	if p.GivenName != "Fred" || p.FamilyName != "Bloggs" || p.Zip != "LS1 4AP" {
+		t.Errorf("setFlatFields() without names or addresses = %+v, want the flat fields kept", p)
+	}
+}
+
+func TestHL7V3NameUse(t *testing.T) {
+	tests := []struct {
+		use, want string
+	}{
+		{"L", "official"},
+		{"OR L", "official"},
+		{"P", "nickname"},
+		{"C", "usual"},
+		{"SRCH", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := hl7v3NameUse(tt.use); got != tt.want {
+			t.Errorf("hl7v3NameUse(%q) = %q, want %q", tt.use, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package tukpdq
+
+import (
+	"net/url"
+
+	"github.com/ipthomas/tukcnst"
+)
+
+const (
+	PDQ_SERVER_TYPE_IHE_PDQM = "pdqm"
+	ENV_IHE_PDQM_SERVER_URL  = "IHE_PDQM_SERVER_URL"
+)
+
+// fhirSearchURL returns the Patient search url for the Used_PID or, for pdqm demographic searches, the query demographics
+func (i *PDQQuery) fhirSearchURL() string {
+	if i.Used_PID != "" {
+		return i.Server_URL + "?identifier=" + url.QueryEscape(Authority_From_OID(i.Used_PID_OID).PIXm_System(i.PIXm_System)) + "|" + url.QueryEscape(i.Used_PID) + tukcnst.FORMAT_JSON_PRETTY
+	}
+	params := url.Values{}
+	for _, p := range []struct{ name, value string }{{"family", i.FamilyName}, {"given", i.GivenName}, {"birthdate", fhirDate(i.BirthDate)},
+		{"gender", normalisedGender(i.Gender)}, {"address-postalcode", i.Zip}} {
+		if p.value != "" {
+			params.Set(p.name, p.value)
+		}
+	}
+	return i.Server_URL + "?" + params.Encode() + tukcnst.FORMAT_JSON_PRETTY
+}
@@ -0,0 +1,554 @@
+package tukpdq
+
+import "strings"
+
+const DOUBLE_METAPHONE_MAX_LENGTH = 4
+
+// Soundex returns the American Soundex code of a name, an uppercase letter followed by three digits
+func Soundex(name string) string {
+	s := phoneticInput(name)
+	s = strings.ReplaceAll(s, " ", "")
+	if s == "" {
+		return ""
+	}
+	code := []byte{s[0]}
+	last := soundexDigit(s[0])
+	for n := 1; n < len(s) && len(code) < 4; n++ {
+		d := soundexDigit(s[n])
+		switch {
+		case s[n] == 'H' || s[n] == 'W':
+			continue
+		case d == 0:
+			last = 0
+		case d != last:
+			code = append(code, d)
+			last = d
+		}
+	}
+	for len(code) < 4 {
+		code = append(code, '0')
+	}
+	return string(code)
+}
+func soundexDigit(c byte) byte {
+	switch c {
+	case 'B', 'F', 'P', 'V':
+		return '1'
+	case 'C', 'G', 'J', 'K', 'Q', 'S', 'X', 'Z':
+		return '2'
+	case 'D', 'T':
+		return '3'
+	case 'L':
+		return '4'
+	case 'M', 'N':
+		return '5'
+	case 'R':
+		return '6'
+	}
+	return 0
+}
+
+// Double_Metaphone returns the primary and alternate Double Metaphone codes of a name
+func Double_Metaphone(name string) (string, string) {
+	m := metaphone{value: phoneticInput(name)}
+	if m.value == "" {
+		return "", ""
+	}
+	m.slavoGermanic = strings.ContainsAny(m.value, "WK") || strings.Contains(m.value, "CZ") || strings.Contains(m.value, "WITZ")
+	index := 0
+	if m.contains(0, 2, "GN", "KN", "PN", "WR", "PS") {
+		index = 1
+	}
+	for !m.complete() && index < len(m.value) {
+		switch m.value[index] {
+		case 'A', 'E', 'I', 'O', 'U', 'Y':
+			if index == 0 {
+				m.add("A")
+			}
+			index++
+		case 'B':
+			m.add("P")
+			index = m.skip(index, "B")
+		case 'C':
+			index = m.handleC(index)
+		case 'D':
+			index = m.handleD(index)
+		case 'F':
+			m.add("F")
+			index = m.skip(index, "F")
+		case 'G':
+			index = m.handleG(index)
+		case 'H':
+			if (index == 0 || isVowel(m.at(index-1))) && isVowel(m.at(index+1)) {
+				m.add("H")
+				index += 2
+			} else {
+				index++
+			}
+		case 'J':
+			index = m.handleJ(index)
+		case 'K':
+			m.add("K")
+			index = m.skip(index, "K")
+		case 'L':
+			index = m.handleL(index)
+		case 'M':
+			m.add("M")
+			if m.at(index+1) == 'M' || (m.contains(index-1, 3, "UMB") && (index+1 == len(m.value)-1 || m.contains(index+2, 2, "ER"))) {
+				index += 2
+			} else {
+				index++
+			}
+		case 'N':
+			m.add("N")
+			index = m.skip(index, "N")
+		case 'P':
+			if m.at(index+1) == 'H' {
+				m.add("F")
+				index += 2
+			} else {
+				m.add("P")
+				index = m.skip(index, "P", "B")
+			}
+		case 'Q':
+			m.add("K")
+			index = m.skip(index, "Q")
+		case 'R':
+			if index == len(m.value)-1 && !m.slavoGermanic && m.contains(index-2, 2, "IE") && !m.contains(index-4, 2, "ME", "MA") {
+				m.addAlt("", "R")
+			} else {
+				m.add("R")
+			}
+			index = m.skip(index, "R")
+		case 'S':
+			index = m.handleS(index)
+		case 'T':
+			index = m.handleT(index)
+		case 'V':
+			m.add("F")
+			index = m.skip(index, "V")
+		case 'W':
+			index = m.handleW(index)
+		case 'X':
+			index = m.handleX(index)
+		case 'Z':
+			index = m.handleZ(index)
+		default:
+			index++
+		}
+	}
+	return m.primary, m.alternate
+}
+
+// Jaro_Winkler returns the Jaro-Winkler similarity of two strings, from 0 for no similarity to 1 for identical strings
+func Jaro_Winkler(a string, b string) float64 {
+	if a == b {
+		return 1
+	}
+	if a == "" || b == "" {
+		return 0
+	}
+	window := len(a)
+	if len(b) > window {
+		window = len(b)
+	}
+	window = window/2 - 1
+	if window < 0 {
+		window = 0
+	}
+	aMatched := make([]bool, len(a))
+	bMatched := make([]bool, len(b))
+	matches := 0
+	for x := 0; x < len(a); x++ {
+		from, to := x-window, x+window+1
+		if from < 0 {
+			from = 0
+		}
+		if to > len(b) {
+			to = len(b)
+		}
+		for y := from; y < to; y++ {
+			if !bMatched[y] && a[x] == b[y] {
+				aMatched[x], bMatched[y] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+	transpositions, y := 0, 0
+	for x := 0; x < len(a); x++ {
+		if !aMatched[x] {
+			continue
+		}
+		for !bMatched[y] {
+			y++
+		}
+		if a[x] != b[y] {
+			transpositions++
+		}
+		y++
+	}
+	m := float64(matches)
+	jaro := (m/float64(len(a)) + m/float64(len(b)) + (m-float64(transpositions)/2)/m) / 3
+	prefix := 0
+	for prefix < 4 && prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+// phoneticInput returns the name in uppercase with everything other than the letters A to Z and single spaces removed
+func phoneticInput(name string) string {
+	var b strings.Builder
+	for _, c := range strings.ToUpper(strings.TrimSpace(name)) {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			b.WriteRune(c)
+		case c == ' ' || c == '-':
+			if b.Len() > 0 && !strings.HasSuffix(b.String(), " ") {
+				b.WriteByte(' ')
+			}
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+func isVowel(c byte) bool {
+	return strings.IndexByte("AEIOUY", c) > -1
+}
+
+type metaphone struct {
+	value         string
+	primary       string
+	alternate     string
+	slavoGermanic bool
+}
+
+func (m *metaphone) at(n int) byte {
+	if n < 0 || n >= len(m.value) {
+		return 0
+	}
+	return m.value[n]
+}
+func (m *metaphone) contains(start int, length int, options ...string) bool {
+	if start < 0 || start+length > len(m.value) {
+		return false
+	}
+	for _, o := range options {
+		if m.value[start:start+length] == o {
+			return true
+		}
+	}
+	return false
+}
+func (m *metaphone) skip(n int, doubles ...string) int {
+	if m.contains(n+1, 1, doubles...) {
+		return n + 2
+	}
+	return n + 1
+}
+func (m *metaphone) add(code string) {
+	m.addAlt(code, code)
+}
+func (m *metaphone) addAlt(primary string, alternate string) {
+	m.primary = truncate(m.primary+primary, DOUBLE_METAPHONE_MAX_LENGTH)
+	m.alternate = truncate(m.alternate+alternate, DOUBLE_METAPHONE_MAX_LENGTH)
+}
+func (m *metaphone) complete() bool {
+	return len(m.primary) >= DOUBLE_METAPHONE_MAX_LENGTH && len(m.alternate) >= DOUBLE_METAPHONE_MAX_LENGTH
+}
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+func (m *metaphone) germanic() bool {
+	return m.contains(0, 4, "VAN ", "VON ") || m.contains(0, 3, "SCH")
+}
+func (m *metaphone) handleC(n int) int {
+	switch {
+	case m.contains(n, 4, "CHIA") || (n > 1 && !isVowel(m.at(n-2)) && m.contains(n-1, 3, "ACH") &&
+		((m.at(n+2) != 'I' && m.at(n+2) != 'E') || m.contains(n-2, 6, "BACHER", "MACHER"))):
+		m.add("K")
+		return n + 2
+	case n == 0 && m.contains(n, 6, "CAESAR"):
+		m.add("S")
+		return n + 2
+	case m.contains(n, 2, "CH"):
+		return m.handleCH(n)
+	case m.contains(n, 2, "CZ") && !m.contains(n-2, 4, "WICZ"):
+		m.addAlt("S", "X")
+		return n + 2
+	case m.contains(n+1, 3, "CIA"):
+		m.add("X")
+		return n + 3
+	case m.contains(n, 2, "CC") && !(n == 1 && m.at(0) == 'M'):
+		if m.contains(n+2, 1, "I", "E", "H") && !m.contains(n+2, 2, "HU") {
+			if (n == 1 && m.at(n-1) == 'A') || m.contains(n-1, 5, "UCCEE", "UCCES") {
+				m.add("KS")
+			} else {
+				m.add("X")
+			}
+			return n + 3
+		}
+		m.add("K")
+		return n + 2
+	case m.contains(n, 2, "CK", "CG", "CQ"):
+		m.add("K")
+		return n + 2
+	case m.contains(n, 2, "CI", "CE", "CY"):
+		if m.contains(n, 3, "CIO", "CIE", "CIA") {
+			m.addAlt("S", "X")
+		} else {
+			m.add("S")
+		}
+		return n + 2
+	}
+	m.add("K")
+	switch {
+	case m.contains(n+1, 2, " C", " Q", " G"):
+		return n + 3
+	case m.contains(n+1, 1, "C", "K", "Q") && !m.contains(n+1, 2, "CE", "CI"):
+		return n + 2
+	}
+	return n + 1
+}
+func (m *metaphone) handleCH(n int) int {
+	switch {
+	case n > 0 && m.contains(n, 4, "CHAE"):
+		m.addAlt("K", "X")
+	case n == 0 && (m.contains(n+1, 5, "HARAC", "HARIS") || m.contains(n+1, 3, "HOR", "HYM", "HIA", "HEM")) && !m.contains(0, 5, "CHORE"):
+		m.add("K")
+	case m.germanic() || m.contains(n-2, 6, "ORCHES", "ARCHIT", "ORCHID") || m.contains(n+2, 1, "T", "S") ||
+		((m.contains(n-1, 1, "A", "O", "U", "E") || n == 0) && (m.contains(n+2, 1, "L", "R", "N", "M", "B", "H", "F", "V", "W", " ") || n+1 == len(m.value)-1)):
+		m.add("K")
+	case n > 0 && m.contains(0, 2, "MC"):
+		m.add("K")
+	case n > 0:
+		m.addAlt("X", "K")
+	default:
+		m.add("X")
+	}
+	return n + 2
+}
+func (m *metaphone) handleD(n int) int {
+	switch {
+	case m.contains(n, 2, "DG"):
+		if m.contains(n+2, 1, "I", "E", "Y") {
+			m.add("J")
+			return n + 3
+		}
+		m.add("TK")
+		return n + 2
+	case m.contains(n, 2, "DT", "DD"):
+		m.add("T")
+		return n + 2
+	}
+	m.add("T")
+	return n + 1
+}
+func (m *metaphone) handleG(n int) int {
+	switch {
+	case m.at(n+1) == 'H':
+		return m.handleGH(n)
+	case m.at(n+1) == 'N':
+		switch {
+		case n == 1 && isVowel(m.at(0)) && !m.slavoGermanic:
+			m.addAlt("KN", "N")
+		case !m.contains(n+2, 2, "EY") && m.at(n+1) != 'Y' && !m.slavoGermanic:
+			m.addAlt("N", "KN")
+		default:
+			m.add("KN")
+		}
+		return n + 2
+	case m.contains(n+1, 2, "LI") && !m.slavoGermanic:
+		m.addAlt("KL", "L")
+		return n + 2
+	case n == 0 && (m.at(n+1) == 'Y' || m.contains(n+1, 2, "ES", "EP", "EB", "EL", "EY", "IB", "IL", "IN", "IE", "EI", "ER")):
+		m.addAlt("K", "J")
+		return n + 2
+	case (m.contains(n+1, 2, "ER") || m.at(n+1) == 'Y') && !m.contains(0, 6, "DANGER", "RANGER", "MANGER") &&
+		!m.contains(n-1, 1, "E", "I") && !m.contains(n-1, 3, "RGY", "OGY"):
+		m.addAlt("K", "J")
+		return n + 2
+	case m.contains(n+1, 1, "E", "I", "Y") || m.contains(n-1, 4, "AGGI", "OGGI"):
+		switch {
+		case m.germanic() || m.contains(n+1, 2, "ET"):
+			m.add("K")
+		case m.contains(n+1, 3, "IER"):
+			m.add("J")
+		default:
+			m.addAlt("J", "K")
+		}
+		return n + 2
+	case m.at(n+1) == 'G':
+		m.add("K")
+		return n + 2
+	}
+	m.add("K")
+	return n + 1
+}
+func (m *metaphone) handleGH(n int) int {
+	switch {
+	case n > 0 && !isVowel(m.at(n-1)):
+		m.add("K")
+	case n == 0:
+		if m.at(n+2) == 'I' {
+			m.add("J")
+		} else {
+			m.add("K")
+		}
+	case (n > 1 && m.contains(n-2, 1, "B", "H", "D")) || (n > 2 && m.contains(n-3, 1, "B", "H", "D")) || (n > 3 && m.contains(n-4, 1, "B", "H")):
+	case n > 2 && m.at(n-1) == 'U' && m.contains(n-3, 1, "C", "G", "L", "R", "T"):
+		m.add("F")
+	case m.at(n-1) != 'I':
+		m.add("K")
+	}
+	return n + 2
+}
+func (m *metaphone) handleJ(n int) int {
+	if m.contains(n, 4, "JOSE") || m.contains(0, 4, "SAN ") {
+		if (n == 0 && m.at(n+4) == ' ') || len(m.value) == 4 || m.contains(0, 4, "SAN ") {
+			m.add("H")
+		} else {
+			m.addAlt("J", "H")
+		}
+		return n + 1
+	}
+	switch {
+	case n == 0:
+		m.addAlt("J", "A")
+	case isVowel(m.at(n-1)) && !m.slavoGermanic && (m.at(n+1) == 'A' || m.at(n+1) == 'O'):
+		m.addAlt("J", "H")
+	case n == len(m.value)-1:
+		m.addAlt("J", "")
+	case !m.contains(n+1, 1, "L", "T", "K", "S", "N", "M", "B", "Z") && !m.contains(n-1, 1, "S", "K", "L"):
+		m.add("J")
+	}
+	return m.skip(n, "J")
+}
+func (m *metaphone) handleL(n int) int {
+	if m.at(n+1) != 'L' {
+		m.add("L")
+		return n + 1
+	}
+	last := len(m.value) - 1
+	if (n == last-2 && m.contains(n-1, 4, "ILLO", "ILLA", "ALLE")) ||
+		((m.contains(last-1, 2, "AS", "OS") || m.contains(last, 1, "A", "O")) && m.contains(n-1, 4, "ALLE")) {
+		m.addAlt("L", "")
+	} else {
+		m.add("L")
+	}
+	return n + 2
+}
+func (m *metaphone) handleS(n int) int {
+	switch {
+	case m.contains(n-1, 3, "ISL", "YSL"):
+		return n + 1
+	case n == 0 && m.contains(n, 5, "SUGAR"):
+		m.addAlt("X", "S")
+		return n + 1
+	case m.contains(n, 2, "SH"):
+		if m.contains(n+1, 4, "HEIM", "HOEK", "HOLM", "HOLZ") {
+			m.add("S")
+		} else {
+			m.add("X")
+		}
+		return n + 2
+	case m.contains(n, 3, "SIO", "SIA") || m.contains(n, 4, "SIAN"):
+		if m.slavoGermanic {
+			m.add("S")
+		} else {
+			m.addAlt("S", "X")
+		}
+		return n + 3
+	case (n == 0 && m.contains(n+1, 1, "M", "N", "L", "W")) || m.contains(n+1, 1, "Z"):
+		m.addAlt("S", "X")
+		return m.skip(n, "Z")
+	case m.contains(n, 2, "SC"):
+		switch {
+		case m.at(n+2) == 'H':
+			switch {
+			case m.contains(n+3, 2, "ER", "EN"):
+				m.addAlt("X", "SK")
+			case m.contains(n+3, 2, "OO", "UY", "ED", "EM"):
+				m.add("SK")
+			case n == 0 && !isVowel(m.at(3)) && m.at(3) != 'W':
+				m.addAlt("X", "S")
+			default:
+				m.add("X")
+			}
+		case m.contains(n+2, 1, "I", "E", "Y"):
+			m.add("S")
+		default:
+			m.add("SK")
+		}
+		return n + 3
+	}
+	if n == len(m.value)-1 && m.contains(n-2, 2, "AI", "OI") {
+		m.addAlt("", "S")
+	} else {
+		m.add("S")
+	}
+	return m.skip(n, "S", "Z")
+}
+func (m *metaphone) handleT(n int) int {
+	switch {
+	case m.contains(n, 4, "TION") || m.contains(n, 3, "TIA", "TCH"):
+		m.add("X")
+		return n + 3
+	case m.contains(n, 2, "TH") || m.contains(n, 3, "TTH"):
+		if m.contains(n+2, 2, "OM", "AM") || m.germanic() {
+			m.add("T")
+		} else {
+			m.addAlt("0", "T")
+		}
+		return n + 2
+	}
+	m.add("T")
+	return m.skip(n, "T", "D")
+}
+func (m *metaphone) handleW(n int) int {
+	switch {
+	case m.contains(n, 2, "WR"):
+		m.add("R")
+		return n + 2
+	case n == 0 && (isVowel(m.at(n+1)) || m.contains(n, 2, "WH")):
+		if isVowel(m.at(n + 1)) {
+			m.addAlt("A", "F")
+		} else {
+			m.add("A")
+		}
+	case (n == len(m.value)-1 && isVowel(m.at(n-1))) || m.contains(n-1, 5, "EWSKI", "EWSKY", "OWSKI", "OWSKY") || m.contains(0, 3, "SCH"):
+		m.addAlt("", "F")
+	case m.contains(n, 4, "WICZ", "WITZ"):
+		m.addAlt("TS", "FX")
+		return n + 4
+	}
+	return n + 1
+}
+func (m *metaphone) handleX(n int) int {
+	if n == 0 {
+		m.add("S")
+		return n + 1
+	}
+	if !(n == len(m.value)-1 && (m.contains(n-3, 3, "IAU", "EAU") || m.contains(n-2, 2, "AU", "OU"))) {
+		m.add("KS")
+	}
+	return m.skip(n, "C", "X")
+}
+func (m *metaphone) handleZ(n int) int {
+	if m.at(n+1) == 'H' {
+		m.add("J")
+		return n + 2
+	}
+	if m.contains(n+1, 2, "ZO", "ZI", "ZA") || (m.slavoGermanic && n > 0 && m.at(n-1) != 'T') {
+		m.addAlt("S", "TS")
+	} else {
+		m.add("S")
+	}
+	return m.skip(n, "Z")
+}
@@ -0,0 +1,83 @@
+package tukpdq
+
+import (
+	"math"
+	"testing"
+)
+
+func TestJaroWinkler(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"MARTHA", "MARHTA", 0.961},
+		{"DWAYNE", "DUANE", 0.840},
+		{"DIXON", "DICKSONX", 0.813},
+		{"JELLYFISH", "SMELLYFISH", 0.896},
+		{"SMITH", "SMITH", 1},
+		{"", "SMITH", 0},
+		{"", "", 1},
+	}
+	for _, tt := range tests {
+		if got := Jaro_Winkler(tt.a, tt.b); math.Abs(got-tt.want) > 0.001 {
+			t.Errorf("Jaro_Winkler(%q, %q) = %.4f, want %.3f", tt.a, tt.b, got, tt.want)
+		}
+		if got, rev := Jaro_Winkler(tt.a, tt.b), Jaro_Winkler(tt.b, tt.a); got != rev {
+			t.Errorf("Jaro_Winkler(%q, %q) = %.4f is not symmetric, reversed %.4f", tt.a, tt.b, got, rev)
+		}
+	}
+}
+
+func TestSoundex(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"Robert", "R163"},
+		{"Rupert", "R163"},
+		{"Rubin", "R150"},
+		{"Ashcraft", "A261"},
+		{"Ashcroft", "A261"},
+		{"Tymczak", "T522"},
+		{"Pfister", "P236"},
+		{"Honeyman", "H555"},
+		{"Lee", "L000"},
+		{"O'Brien", "O165"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Soundex(tt.name); got != tt.want {
+			t.Errorf("Soundex(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDoubleMetaphone(t *testing.T) {
+	tests := []struct {
+		name, primary, alternate string
+	}{
+		{"Smith", "SM0", "XMT"},
+		{"Schmidt", "XMT", "SMT"},
+		{"Jones", "JNS", "ANS"},
+		{"Johnson", "JNSN", "ANSN"},
+		{"Williams", "ALMS", "FLMS"},
+		{"Wilkinson", "ALKN", "FLKN"},
+		{"Taylor", "TLR", "TLR"},
+		{"Brown", "PRN", "PRN"},
+		{"Davies", "TFS", "TFS"},
+		{"Evans", "AFNS", "AFNS"},
+		{"Thomas", "TMS", "TMS"},
+		{"Wright", "RT", "RT"},
+		{"Hughes", "HS", "HS"},
+		{"Knight", "NT", "NT"},
+		{"Phillips", "FLPS", "FLPS"},
+		{"Campbell", "KMPL", "KMPL"},
+		{"MacDonald", "MKTN", "MKTN"},
+		{"O'Neill", "ANL", "ANL"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		if primary, alternate := Double_Metaphone(tt.name); primary != tt.primary || alternate != tt.alternate {
+			t.Errorf("Double_Metaphone(%q) = %q, %q, want %q, %q", tt.name, primary, alternate, tt.primary, tt.alternate)
+		}
+	}
+}
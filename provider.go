@@ -0,0 +1,107 @@
+package tukpdq
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/ipthomas/tukcnst"
+	"github.com/ipthomas/tukhttp"
+)
+
+// Provider is a patient lookup adapter for a Server_Mode
+type Provider interface {
+	New_Request(i *PDQQuery) (*tukhttp.HTTPRequest, error)
+	Send(i *PDQQuery, httpReq *tukhttp.HTTPRequest) error
+	Map_Patients(i *PDQQuery, rsp []byte) ([]TUKPatient, error)
+}
+
+var providers = struct {
+	sync.RWMutex
+	byMode map[string]Provider
+}{byMode: map[string]Provider{}}
+
+func init() {
+	Register_Provider(tukcnst.PDQ_SERVER_TYPE_CGL, cglProvider{})
+	Register_Provider(PDQ_SERVER_TYPE_DELPHI, delphiProvider{})
+}
+
+// Register_Provider adds or replaces the provider for a Server_Mode
+func Register_Provider(mode string, p Provider) error {
+	if mode == "" || p == nil {
+		return errors.New("invalid provider - server mode and provider are required")
+	}
+	providers.Lock()
+	defer providers.Unlock()
+	providers.byMode[mode] = p
+	return nil
+}
+
+// Registered_Provider returns the provider registered for the Server_Mode. False is returned if no provider is registered
+func Registered_Provider(mode string) (Provider, bool) {
+	providers.RLock()
+	defer providers.RUnlock()
+	p, ok := providers.byMode[mode]
+	return p, ok
+}
+
+// Registered_Modes returns the sorted server modes that have a registered provider
+func Registered_Modes() []string {
+	providers.RLock()
+	defer providers.RUnlock()
+	modes := make([]string, 0, len(providers.byMode))
+	for mode := range providers.byMode {
+		modes = append(modes, mode)
+	}
+	sort.Strings(modes)
+	return modes
+}
+
+// Send_Request sends the http request using the query HTTPClient if set. Providers can use it to implement Send
+func (i *PDQQuery) Send_Request(httpReq *tukhttp.HTTPRequest) error {
+	return i.newHTTPRequest(httpReq)
+}
+
+// newProviderStatusError returns the OutcomeError for a provider response status other than 200
+func newProviderStatusError(statusCode int) *OutcomeError {
+	outcome := OUTCOME_SERVER_ERROR
+	if statusCode == http.StatusNotFound {
+		outcome = OUTCOME_SOURCE_IDENTIFIER_NOT_FOUND
+	}
+	return &OutcomeError{StatusCode: statusCode, Outcome: outcome, Issues: []OperationOutcomeIssue{{Severity: "error", Code: "exception", Diagnostics: http.StatusText(statusCode)}}}
+}
+
+// setProviderPatients builds, sends and maps the provider request and sets the returned patients as the query patients
+func (i *PDQQuery) setProviderPatients(p Provider) error {
+	httpReq, err := p.New_Request(i)
+	if err != nil {
+		return err
+	}
+	if i.Request = httpReq.Body; len(i.Request) == 0 {
+		i.Request = []byte(httpReq.URL)
+	}
+	err = p.Send(i, httpReq)
+	i.Response = httpReq.Response
+	i.StatusCode = httpReq.StatusCode
+	if err != nil {
+		return err
+	}
+	if httpReq.StatusCode != http.StatusOK {
+		return newProviderStatusError(httpReq.StatusCode)
+	}
+	pats, err := p.Map_Patients(i, httpReq.Response)
+	if err != nil {
+		return err
+	}
+	i.Count = len(pats)
+	for _, pat := range pats {
+		i.addPatient(pat)
+	}
+	if i.rankPatients() {
+		if pat, ok := i.resolvedPatient(); ok {
+			i.setQueryDemographics(pat)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package tukpdq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ipthomas/tukcnst"
+	"github.com/ipthomas/tukhttp"
+)
+
+const testProviderMode = "test-provider"
+
+// testProvider looks up the Used_PID on a local patient API returning a json array of family names
+type testProvider struct{}
+
+func (testProvider) New_Request(i *PDQQuery) (*tukhttp.HTTPRequest, error) {
+	return &tukhttp.HTTPRequest{Method: http.MethodGet, URL: i.Server_URL + "/" + i.Used_PID, Timeout: i.Timeout}, nil
+}
+func (testProvider) Send(i *PDQQuery, httpReq *tukhttp.HTTPRequest) error {
+	return i.Send_Request(httpReq)
+}
+func (testProvider) Map_Patients(i *PDQQuery, rsp []byte) ([]TUKPatient, error) {
+	var names []string
+	if err := json.Unmarshal(rsp, &names); err != nil {
+		return nil, err
+	}
+	var pats []TUKPatient
+	for _, name := range names {
+		pats = append(pats, TUKPatient{FamilyName: name, NHSOID: i.NHS_OID, NHSID: i.Used_PID})
+	}
+	return pats, nil
+}
+
+func TestRegisterProvider(t *testing.T) {
+	if err := Register_Provider("", testProvider{}); err == nil {
+		t.Error("Register_Provider() with no mode = nil, want error")
+	}
+	if err := Register_Provider(testProviderMode, nil); err == nil {
+		t.Error("Register_Provider() with no provider = nil, want error")
+	}
+	if err := Register_Provider(testProviderMode, testProvider{}); err != nil {
+		t.Fatalf("Register_Provider() error = %v", err)
+	}
+	if p, ok := Registered_Provider(testProviderMode); !ok || p != (testProvider{}) {
+		t.Errorf("Registered_Provider(%s) = %v, %v, want the test provider", testProviderMode, p, ok)
+	}
+	if _, ok := Registered_Provider(tukcnst.PDQ_SERVER_TYPE_IHE_PIXM); ok {
+		t.Error("Registered_Provider(pixm) = true, want false")
+	}
+	modes := Registered_Modes()
+	if !sort.StringsAreSorted(modes) {
+		t.Errorf("Registered_Modes() = %v, want sorted modes", modes)
+	}
+	for _, mode := range []string{tukcnst.PDQ_SERVER_TYPE_CGL, PDQ_SERVER_TYPE_DELPHI, testProviderMode} {
+		if !contains(modes, mode) {
+			t.Errorf("Registered_Modes() = %v, want %s included", modes, mode)
+		}
+	}
+}
+
+func TestProviderTransaction(t *testing.T) {
+	if err := Register_Provider(testProviderMode, testProvider{}); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, "/") {
+		case "9999999468":
+			fmt.Fprint(w, `["Bloggs","Blogs"]`)
+		case "9434765919":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	newQuery := func(nhs string) PDQQuery {
+		return PDQQuery{Server_Mode: testProviderMode, Server_URL: srv.URL, REG_OID: "2.16.840.1.113883.2.1.3.31.2.1.1", NHS_ID: nhs, HTTPClient: http.DefaultClient}
+	}
+	i := newQuery("9999999468")
+	if err := New_Transaction(&i); err != nil {
+		t.Fatalf("New_Transaction() error = %v", err)
+	}
+	if i.Count != 2 || len(*i.Patients) != 2 || (*i.Patients)[1].FamilyName != "Blogs" || string(i.Request) != srv.URL+"/9999999468" || i.StatusCode != http.StatusOK {
+		t.Errorf("Count = %v, Patients = %+v, Request = %s, StatusCode = %v", i.Count, i.Patients, i.Request, i.StatusCode)
+	}
+	tests := []struct {
+		nhs     string
+		status  int
+		outcome string
+	}{
+		{"9434765919", http.StatusNotFound, OUTCOME_SOURCE_IDENTIFIER_NOT_FOUND},
+		{"4010232137", http.StatusServiceUnavailable, OUTCOME_SERVER_ERROR},
+	}
+	for _, tt := range tests {
+		i = newQuery(tt.nhs)
+		err := New_Transaction(&i)
+		var oe *OutcomeError
+		if !errors.As(err, &oe) || oe.StatusCode != tt.status || oe.Outcome != tt.outcome || i.StatusCode != tt.status || i.Count != 0 {
+			t.Errorf("New_Transaction(%s) error = %v, StatusCode = %v, want %s with status %v", tt.nhs, err, i.StatusCode, tt.outcome, tt.status)
+			continue
+		}
+		if !strings.Contains(err.Error(), fmt.Sprint(tt.status)) {
+			t.Errorf("New_Transaction(%s) error = %v, want the status code included", tt.nhs, err)
+		}
+	}
+}
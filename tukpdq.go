@@ -2,54 +2,76 @@ package tukpdq
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
-	"text/template"
+	"time"
 
 	"github.com/ipthomas/tukcnst"
 	"github.com/ipthomas/tukhttp"
-	"github.com/ipthomas/tukutil"
 )
 
 type PDQQuery struct {
-	Server_Mode      string           `json:",omitempty"`
-	Server_URL       string           `json:",omitempty"`
-	CGL_X_Api_Key    string           `json:",omitempty"`
-	CGL_X_Api_Secret string           `json:",omitempty"`
-	NHS_ID           string           `json:",omitempty"`
-	NHS_OID          string           `json:",omitempty"`
-	MRN_ID           string           `json:",omitempty"`
-	MRN_OID          string           `json:",omitempty"`
-	REG_ID           string           `json:",omitempty"`
-	REG_OID          string           `json:",omitempty"`
-	GivenName        string           `json:"givenname"`
-	FamilyName       string           `json:"familyname"`
-	BirthDate        string           `json:"birthdate"`
-	Gender           string           `json:"gender"`
-	Zip              string           `json:"zip"`
-	Street           string           `json:"street"`
-	Town             string           `json:"town"`
-	City             string           `json:"city"`
-	Country          string           `json:"country"`
-	Timeout          int              `json:",omitempty"`
-	Used_PID         string           `json:",omitempty"`
-	Used_PID_OID     string           `json:",omitempty"`
-	Request          []byte           `json:",omitempty"`
-	Response         []byte           `json:",omitempty"`
-	StatusCode       int              `json:",omitempty"`
-	Count            int              `json:",omitempty"`
-	DebugMode        bool             `json:",omitempty"`
-	PDQv3Response    *PDQv3Response   `json:",omitempty"`
-	PIXv3Response    *PIXv3Response   `json:",omitempty"`
-	PIXmResponse     *PIXmResponse    `json:",omitempty"`
-	Patients         *[]TUKPatient    `json:",omitempty"`
-	CGLUserResponse  *CGLUserResponse `json:",omitempty"`
+	Server_Mode             string               `json:",omitempty"`
+	Server_URL              string               `json:",omitempty"`
+	CGL_X_Api_Key           string               `json:",omitempty"`
+	CGL_X_Api_Secret        string               `json:",omitempty"`
+	NHS_ID                  string               `json:",omitempty"`
+	NHS_OID                 string               `json:",omitempty"`
+	MRN_ID                  string               `json:",omitempty"`
+	MRN_OID                 string               `json:",omitempty"`
+	REG_ID                  string               `json:",omitempty"`
+	REG_OID                 string               `json:",omitempty"`
+	GivenName               string               `json:"givenname"`
+	FamilyName              string               `json:"familyname"`
+	BirthDate               string               `json:"birthdate"`
+	Gender                  string               `json:"gender"`
+	Zip                     string               `json:"zip"`
+	Street                  string               `json:"street"`
+	Town                    string               `json:"town"`
+	City                    string               `json:"city"`
+	Country                 string               `json:"country"`
+	Timeout                 int                  `json:",omitempty"`
+	Used_PID                string               `json:",omitempty"`
+	Used_PID_OID            string               `json:",omitempty"`
+	Request                 []byte               `json:",omitempty"`
+	Response                []byte               `json:",omitempty"`
+	StatusCode              int                  `json:",omitempty"`
+	Count                   int                  `json:",omitempty"`
+	DebugMode               bool                 `json:",omitempty"`
+	PDQv3Response           *PDQv3Response       `json:",omitempty"`
+	PIXv3Response           *PIXv3Response       `json:",omitempty"`
+	PIXmResponse            *PIXmResponse        `json:",omitempty"`
+	Patients                *[]TUKPatient        `json:",omitempty"`
+	CGLUserResponse         *CGLUserResponse     `json:",omitempty"`
+	DelphiResponse          *Delphi              `json:",omitempty"`
+	OperationOutcome        *OperationOutcome    `json:",omitempty"`
+	Sender                  HL7V3Device_Config   `json:",omitempty"`
+	Receiver                HL7V3Device_Config   `json:",omitempty"`
+	Message_ID_Root         string               `json:",omitempty"`
+	HTTPClient              *http.Client         `json:"-"`
+	Identifiers             []PatientID          `json:",omitempty"`
+	Target_Domains          []string             `json:",omitempty"`
+	Reject_Test_NHS_Numbers bool                 `json:",omitempty"`
+	Issues                  []string             `json:",omitempty"`
+	Min_Match_Score         float64              `json:",omitempty"`
+	Match_Sort_Order        string               `json:",omitempty"`
+	Match_Config            *Match_Config        `json:",omitempty"`
+	Survivorship            *Survivorship_Config `json:",omitempty"`
+	Patient_Groups          []PatientGroup       `json:",omitempty"`
+	Follow_Replaced_By      bool                 `json:",omitempty"`
+	Delphi_X_Api_Key        string               `json:",omitempty"`
+	Delphi_X_Api_Secret     string               `json:",omitempty"`
+	Delphi_Local_ID         string               `json:",omitempty"`
+	Delphi_Local_ID_OID     string               `json:",omitempty"`
+	PIXm_System             string               `json:",omitempty"`
 }
 type Delphi struct {
 	Data struct {
@@ -385,7 +407,7 @@ type PDQv3Response struct {
 					Code       string `xml:"code,attr"`
 					CodeSystem string `xml:"codeSystem,attr"`
 				} `xml:"code"`
-				Subject struct {
+				Subject []struct {
 					Text                 string `xml:",chardata"`
 					ContextConductionInd string `xml:"contextConductionInd,attr"`
 					TypeCode             string `xml:"typeCode,attr"`
@@ -425,11 +447,13 @@ type PDQv3Response struct {
 									Text           string `xml:",chardata"`
 									ClassCode      string `xml:"classCode,attr"`
 									DeterminerCode string `xml:"determinerCode,attr"`
-									Name           struct {
-										Text   string `xml:",chardata"`
-										Use    string `xml:"use,attr"`
-										Given  string `xml:"given"`
-										Family string `xml:"family"`
+									Name           []struct {
+										Text   string   `xml:",chardata"`
+										Use    string   `xml:"use,attr"`
+										Prefix []string `xml:"prefix"`
+										Given  []string `xml:"given"`
+										Family string   `xml:"family"`
+										Suffix []string `xml:"suffix"`
 									} `xml:"name"`
 									Telecom []struct {
 										Text  string `xml:",chardata"`
@@ -438,6 +462,7 @@ type PDQv3Response struct {
 									} `xml:"telecom"`
 									AdministrativeGenderCode struct {
 										Text           string `xml:",chardata"`
+										NullFlavor     string `xml:"nullFlavor,attr"`
 										Code           string `xml:"code,attr"`
 										CodeSystem     string `xml:"codeSystem,attr"`
 										CodeSystemName string `xml:"codeSystemName,attr"`
@@ -454,13 +479,15 @@ type PDQv3Response struct {
 										Text  string `xml:",chardata"`
 										Value string `xml:"value,attr"`
 									} `xml:"multipleBirthInd"`
-									Addr struct {
-										Text              string `xml:",chardata"`
-										StreetAddressLine string `xml:"streetAddressLine"`
-										City              string `xml:"city"`
-										State             string `xml:"state"`
-										PostalCode        string `xml:"postalCode"`
-										Country           string `xml:"country"`
+									Addr []struct {
+										Text              string   `xml:",chardata"`
+										Use               string   `xml:"use,attr"`
+										StreetAddressLine []string `xml:"streetAddressLine"`
+										City              string   `xml:"city"`
+										County            string   `xml:"county"`
+										State             string   `xml:"state"`
+										PostalCode        string   `xml:"postalCode"`
+										Country           string   `xml:"country"`
 									} `xml:"addr"`
 									MaritalStatusCode struct {
 										Text           string `xml:",chardata"`
@@ -756,10 +783,26 @@ type PIXv3Response struct {
 								PatientPerson struct {
 									ClassCode      string `xml:"classCode,attr"`
 									DeterminerCode string `xml:"determinerCode,attr"`
-									Name           struct {
-										Given  string `xml:"given"`
-										Family string `xml:"family"`
+									Name           []struct {
+										Use    string   `xml:"use,attr"`
+										Prefix []string `xml:"prefix"`
+										Given  []string `xml:"given"`
+										Family string   `xml:"family"`
+										Suffix []string `xml:"suffix"`
 									} `xml:"name"`
+									AsOtherIDs []struct {
+										ClassCode string `xml:"classCode,attr"`
+										ID        []struct {
+											Extension              string `xml:"extension,attr"`
+											Root                   string `xml:"root,attr"`
+											AssigningAuthorityName string `xml:"assigningAuthorityName,attr"`
+										} `xml:"id"`
+										ScopingOrganization struct {
+											ID struct {
+												Root string `xml:"root,attr"`
+											} `xml:"id"`
+										} `xml:"scopingOrganization"`
+									} `xml:"asOtherIDs"`
 								} `xml:"patientPerson"`
 							} `xml:"patient"`
 						} `xml:"subject1"`
@@ -831,50 +874,72 @@ type PIXmResponse struct {
 		URL      string `json:"url"`
 	} `json:"link"`
 	Entry []struct {
-		FullURL  string `json:"fullUrl"`
-		Resource struct {
-			ResourceType string `json:"resourceType"`
-			ID           string `json:"id"`
-			Identifier   []struct {
-				Use    string `json:"use,omitempty"`
-				System string `json:"system"`
-				Value  string `json:"value"`
-			} `json:"identifier"`
-			Active bool `json:"active"`
-			Name   []struct {
-				Use    string   `json:"use"`
-				Family string   `json:"family"`
-				Given  []string `json:"given"`
-			} `json:"name"`
-			Gender    string `json:"gender"`
-			BirthDate string `json:"birthDate"`
-			Address   []struct {
-				Use        string   `json:"use"`
-				Line       []string `json:"line"`
-				City       string   `json:"city"`
-				PostalCode string   `json:"postalCode"`
-				Country    string   `json:"country"`
-			} `json:"address"`
-		} `json:"resource"`
+		FullURL  string       `json:"fullUrl"`
+		Resource PIXmResource `json:"resource"`
 	} `json:"entry"`
 }
+type PIXmResource struct {
+	ResourceType string `json:"resourceType"`
+	ID           string `json:"id"`
+	Meta         struct {
+		LastUpdated string `json:"lastUpdated,omitempty"`
+	} `json:"meta,omitempty"`
+	Issue      []OperationOutcomeIssue `json:"issue,omitempty"`
+	Identifier []struct {
+		Use    string `json:"use,omitempty"`
+		System string `json:"system"`
+		Value  string `json:"value"`
+	} `json:"identifier"`
+	Active    *bool       `json:"active,omitempty"`
+	Name      []HumanName `json:"name"`
+	Telecom   []Telecom   `json:"telecom,omitempty"`
+	Gender    string      `json:"gender"`
+	BirthDate string      `json:"birthDate"`
+	Address   []Address   `json:"address"`
+	Link      []struct {
+		Other struct {
+			Reference string `json:"reference,omitempty"`
+		} `json:"other"`
+		Type string `json:"type"`
+	} `json:"link,omitempty"`
+}
 type TUKPatient struct {
-	PIDOID     string `json:"pidoid"`
-	PID        string `json:"pid"`
-	REGOID     string `json:"regoid"`
-	REGID      string `json:"regid"`
-	NHSOID     string `json:"nhsoid"`
-	NHSID      string `json:"nhsid"`
-	GivenName  string `json:"givenname"`
-	FamilyName string `json:"familyname"`
-	Gender     string `json:"gender"`
-	BirthDate  string `json:"birthdate"`
-	Street     string `json:"street"`
-	Town       string `json:"town"`
-	City       string `json:"city"`
-	State      string `json:"state"`
-	Country    string `json:"country"`
-	Zip        string `json:"zip"`
+	PIDOID        string       `json:"pidoid"`
+	PID           string       `json:"pid"`
+	PIDSystem     string       `json:"pidsystem,omitempty"`
+	REGOID        string       `json:"regoid"`
+	REGID         string       `json:"regid"`
+	NHSOID        string       `json:"nhsoid"`
+	NHSID         string       `json:"nhsid"`
+	GivenName     string       `json:"givenname"`
+	FamilyName    string       `json:"familyname"`
+	Gender        string       `json:"gender"`
+	BirthDate     string       `json:"birthdate"`
+	Street        string       `json:"street"`
+	Town          string       `json:"town"`
+	City          string       `json:"city"`
+	State         string       `json:"state"`
+	Country       string       `json:"country"`
+	Zip           string       `json:"zip"`
+	Identifiers   []PatientID  `json:"identifiers,omitempty"`
+	Issues        []string     `json:"issues,omitempty"`
+	Telecom       []Telecom    `json:"telecom,omitempty"`
+	Deceased      bool         `json:"deceased,omitempty"`
+	MultipleBirth bool         `json:"multiplebirth,omitempty"`
+	MaritalStatus string       `json:"maritalstatus,omitempty"`
+	BirthPlace    string       `json:"birthplace,omitempty"`
+	Names         []HumanName  `json:"names,omitempty"`
+	MatchScore    float64      `json:"matchscore,omitempty"`
+	Match         *MatchResult `json:"match,omitempty"`
+	Source        string       `json:"source,omitempty"`
+	LastUpdated   string       `json:"lastupdated,omitempty"`
+	Reference     string       `json:"reference,omitempty"`
+	Status        string       `json:"status,omitempty"`
+	Inactive      bool         `json:"inactive,omitempty"`
+	ReplacedBy    []string     `json:"replacedby,omitempty"`
+	Replaces      []string     `json:"replaces,omitempty"`
+	CGLSummary    *CGLSummary  `json:"cglsummary,omitempty"`
+	Addresses     []Address    `json:"addresses,omitempty"`
 }
 type PDQInterface interface {
 	pdq() error
@@ -887,15 +952,19 @@ func (i *PDQQuery) pdq() error {
 	if err := i.setPDQ_ID(); err != nil {
 		return err
 	}
-	return i.setPatient()
+	if err := i.setPatient(); err != nil {
+		return err
+	}
+	i.groupPatients()
+	return nil
 }
 func (i *PDQQuery) setPDQ_ID() error {
 	if i.Server_URL == "" {
-		return errors.New("invalid request - pdq server url is not set")
+		return &ConfigurationError{Setting: "pdq server url", Reason: "is not set"}
 	}
 	if i.REG_OID == "" {
-		if os.Getenv(tukcnst.ENV_REG_OID) == "" {
-			return errors.New("invalid request - reg oid is not set")
+		if i.REG_OID = os.Getenv(tukcnst.ENV_REG_OID); i.REG_OID == "" {
+			return &ConfigurationError{Setting: "reg oid", Reason: "is not set"}
 		}
 	}
 	if i.Timeout == 0 {
@@ -904,6 +973,11 @@ func (i *PDQQuery) setPDQ_ID() error {
 	if i.NHS_OID == "" {
 		i.NHS_OID = tukcnst.NHS_OID_DEFAULT
 	}
+	i.setIdentifiers()
+	if err := i.Validate(); err != nil {
+		return err
+	}
+	i.NHS_ID = Normalise_NHS_Number(i.NHS_ID)
 	if i.MRN_ID != "" && i.MRN_OID != "" {
 		i.Used_PID = i.MRN_ID
 		i.Used_PID_OID = i.MRN_OID
@@ -918,158 +992,167 @@ func (i *PDQQuery) setPDQ_ID() error {
 			}
 		}
 	}
+	if i.Used_PID == "" {
+		for _, id := range i.Identifiers {
+			if id.Value != "" && id.Authority.OID != "" {
+				i.Used_PID = id.Value
+				i.Used_PID_OID = id.Authority.OID
+				break
+			}
+		}
+	}
+	if i.Used_PID == "" && i.Server_Mode == PDQ_SERVER_TYPE_DELPHI && i.Delphi_Local_ID != "" {
+		if i.Delphi_Local_ID_OID == "" {
+			return &ConfigurationError{Setting: "delphi local id oid", Reason: "is not set"}
+		}
+		i.Used_PID = i.Delphi_Local_ID
+		i.Used_PID_OID = i.Delphi_Local_ID_OID
+	}
+	if i.Used_PID == "" && (i.Server_Mode == tukcnst.PDQ_SERVER_TYPE_IHE_PDQV3 || i.Server_Mode == PDQ_SERVER_TYPE_IHE_PDQM) && i.Is_Demographic_Search() {
+		if countSet(i.GivenName, i.FamilyName, i.BirthDate) == 0 {
+			return &ValidationError{Field: i.Server_Mode + " demographic searches", Reason: "require a given name, family name or birth date"}
+		}
+		if i.Server_Mode == PDQ_SERVER_TYPE_IHE_PDQM {
+			return nil
+		}
+		return i.setHL7V3Devices()
+	}
 	if i.Used_PID == "" || i.Used_PID_OID == "" {
-		return errors.New("invalid request - no suitable patient id and oid provided that can be used for pdq query")
+		if i.Is_Demographic_Search() {
+			return &ValidationError{Field: "no patient id", Reason: "provided, demographic searches are only supported by pdqv3 and pdqm servers"}
+		}
+		return &ValidationError{Field: "no suitable patient id and oid", Reason: "provided that can be used for pdq query"}
+	}
+	if i.Server_Mode == tukcnst.PDQ_SERVER_TYPE_IHE_PIXV3 || i.Server_Mode == tukcnst.PDQ_SERVER_TYPE_IHE_PDQV3 {
+		return i.setHL7V3Devices()
 	}
 	return nil
 }
 func (i *PDQQuery) setPatient() error {
-	var tmplt *template.Template
 	var err error
 	i.StatusCode = http.StatusOK
-	switch i.Server_Mode {
-	case tukcnst.PDQ_SERVER_TYPE_CGL:
-		i.Request = []byte(i.Server_URL + i.NHS_ID)
-		httpReq := tukhttp.HTTPRequest{
-			Method:       http.MethodGet,
-			URL:          i.Server_URL + i.NHS_ID,
-			X_Api_Key:    i.CGL_X_Api_Key,
-			X_Api_Secret: i.CGL_X_Api_Secret,
-			DebugMode:    i.DebugMode,
+	if p, ok := Registered_Provider(i.Server_Mode); ok {
+		if err = i.setProviderPatients(p); err != nil {
+			log.Println(err.Error())
 		}
-		if err = tukhttp.NewRequest(&httpReq); err == nil {
-			if httpReq.StatusCode == http.StatusOK {
-				json.Unmarshal(httpReq.Response, &i.CGLUserResponse)
-				i.Count = 1
-			}
-		}
-		i.Response = httpReq.Response
-		i.StatusCode = httpReq.StatusCode
+		return err
+	}
+	switch i.Server_Mode {
 	case tukcnst.PDQ_SERVER_TYPE_IHE_PIXV3:
-		if tmplt, err = template.New(tukcnst.PDQ_SERVER_TYPE_IHE_PIXV3).Funcs(tukutil.TemplateFuncMap()).Parse(tukcnst.GO_Template_PIX_V3_Request); err == nil {
-			var b bytes.Buffer
-			if err = tmplt.Execute(&b, i); err == nil {
-				i.Request = b.Bytes()
-				if err = i.newIHESOAPRequest(tukcnst.SOAP_ACTION_PIXV3_Request); err == nil {
-					if err = xml.Unmarshal(i.Response, &i.PIXv3Response); err == nil {
-						if i.PIXv3Response.Body.PRPAIN201310UV02.Acknowledgement.TypeCode.Code != "AA" {
-							err = errors.New("acknowledgement code not equal aa, received " + i.PIXv3Response.Body.PRPAIN201310UV02.Acknowledgement.TypeCode.Code)
-						} else {
-							i.Count, _ = strconv.Atoi(i.PIXv3Response.Body.PRPAIN201310UV02.ControlActProcess.QueryAck.ResultTotalQuantity.Value)
-							if i.Count > 0 {
-								pat := TUKPatient{
-									PIDOID: i.MRN_OID,
-									PID:    i.MRN_ID,
-									REGOID: i.REG_OID,
-									REGID:  i.REG_ID,
-									NHSOID: i.NHS_OID,
-									NHSID:  i.NHS_ID,
-								}
-								pat.GivenName = i.PIXv3Response.Body.PRPAIN201310UV02.ControlActProcess.Subject.RegistrationEvent.Subject1.Patient.PatientPerson.Name.Given
-								pat.FamilyName = i.PIXv3Response.Body.PRPAIN201310UV02.ControlActProcess.Subject.RegistrationEvent.Subject1.Patient.PatientPerson.Name.Family
-								for _, pid := range i.PIXv3Response.Body.PRPAIN201310UV02.ControlActProcess.Subject.RegistrationEvent.Subject1.Patient.ID {
-									switch pid.Root {
-									case i.REG_OID:
-										pat.REGID = pid.Extension
-									case i.NHS_OID:
-										pat.NHSID = pid.Extension
-									case i.MRN_OID:
-										pat.PID = pid.Extension
-										pat.PIDOID = i.MRN_OID
-									}
+		if i.Request, err = xml.Marshal(i.newPIXv3Request()); err == nil {
+			if err = i.newIHESOAPRequest(tukcnst.SOAP_ACTION_PIXV3_Request); err == nil {
+				if err = xml.Unmarshal(i.Response, &i.PIXv3Response); err == nil {
+					if i.PIXv3Response.Body.PRPAIN201310UV02.Acknowledgement.TypeCode.Code != "AA" {
+						err = errors.New("acknowledgement code not equal aa, received " + i.PIXv3Response.Body.PRPAIN201310UV02.Acknowledgement.TypeCode.Code)
+					} else {
+						i.Count, _ = strconv.Atoi(i.PIXv3Response.Body.PRPAIN201310UV02.ControlActProcess.QueryAck.ResultTotalQuantity.Value)
+						if i.Count > 0 {
+							pat := TUKPatient{
+								PIDOID: i.MRN_OID,
+								PID:    i.MRN_ID,
+								REGOID: i.REG_OID,
+								REGID:  i.REG_ID,
+								NHSOID: i.NHS_OID,
+								NHSID:  i.NHS_ID,
+							}
+							rsppat := i.PIXv3Response.Body.PRPAIN201310UV02.ControlActProcess.Subject.RegistrationEvent.Subject1.Patient
+							for _, name := range rsppat.PatientPerson.Name {
+								pat.Names = append(pat.Names, HumanName{Use: hl7v3NameUse(name.Use), Prefix: name.Prefix, Given: name.Given, Family: name.Family, Suffix: name.Suffix})
+							}
+							pat.setFlatFields()
+							for _, pid := range rsppat.ID {
+								pat.addID(i, newHL7V3PatientID(pid.Root, pid.Extension, pid.AssigningAuthorityName))
+							}
+							for _, other := range rsppat.PatientPerson.AsOtherIDs {
+								for _, pid := range other.ID {
+									pat.addID(i, newHL7V3PatientID(pid.Root, pid.Extension, pid.AssigningAuthorityName))
 								}
 							}
+							i.addPatient(pat)
 						}
 					}
 				}
 			}
 		}
 	case tukcnst.PDQ_SERVER_TYPE_IHE_PDQV3:
-		if tmplt, err = template.New(tukcnst.PDQ_SERVER_TYPE_IHE_PDQV3).Funcs(tukutil.TemplateFuncMap()).Parse(tukcnst.GO_Template_PDQ_V3_Request); err == nil {
-			var b bytes.Buffer
-			if err = tmplt.Execute(&b, i); err == nil {
-				i.Request = b.Bytes()
-				if err = i.newIHESOAPRequest(tukcnst.SOAP_ACTION_PDQV3_Request); err == nil {
-					if err = xml.Unmarshal(i.Response, &i.PDQv3Response); err == nil {
-						if i.PDQv3Response.Body.PRPAIN201306UV02.Acknowledgement.TypeCode.Code != "AA" {
-							err = errors.New("acknowledgement code not equal aa, received " + i.PDQv3Response.Body.PRPAIN201306UV02.Acknowledgement.TypeCode.Code)
-						} else {
-							i.Count, _ = strconv.Atoi(i.PDQv3Response.Body.PRPAIN201306UV02.ControlActProcess.QueryAck.ResultTotalQuantity.Value)
-							if i.Count > 0 {
-								for _, pid := range i.PDQv3Response.Body.PRPAIN201306UV02.ControlActProcess.Subject.RegistrationEvent.Subject1.Patient.ID {
-									switch pid.Root {
-									case i.REG_OID:
-										i.REG_ID = pid.Extension
-									case i.NHS_OID:
-										i.NHS_ID = pid.Extension
-									case i.MRN_OID:
-										i.MRN_ID = pid.Extension
-									}
+		if i.Request, err = xml.Marshal(i.newPDQv3Request()); err == nil {
+			if err = i.newIHESOAPRequest(tukcnst.SOAP_ACTION_PDQV3_Request); err == nil {
+				if err = xml.Unmarshal(i.Response, &i.PDQv3Response); err == nil {
+					if i.PDQv3Response.Body.PRPAIN201306UV02.Acknowledgement.TypeCode.Code != "AA" {
+						err = errors.New("acknowledgement code not equal aa, received " + i.PDQv3Response.Body.PRPAIN201306UV02.Acknowledgement.TypeCode.Code)
+					} else {
+						i.Count, _ = strconv.Atoi(i.PDQv3Response.Body.PRPAIN201306UV02.ControlActProcess.QueryAck.ResultTotalQuantity.Value)
+						if i.Count > 0 {
+							for _, subject := range i.PDQv3Response.Body.PRPAIN201306UV02.ControlActProcess.Subject {
+								pat := TUKPatient{}
+								rsppat := subject.RegistrationEvent.Subject1.Patient
+								for _, pid := range rsppat.ID {
+									pat.addID(i, newHL7V3PatientID(pid.Root, pid.Extension, pid.AssigningAuthorityName))
+								}
+								person := rsppat.PatientPerson
+								for _, name := range person.Name {
+									pat.Names = append(pat.Names, HumanName{Use: hl7v3NameUse(name.Use), Prefix: name.Prefix, Given: name.Given, Family: name.Family, Suffix: name.Suffix})
+								}
+								for _, addr := range person.Addr {
+									a := Address{Line: addr.StreetAddressLine, City: addr.City, District: addr.County, State: addr.State, PostalCode: addr.PostalCode, Country: addr.Country}
+									a.Use, a.Type = hl7v3AddressUse(addr.Use)
+									pat.Addresses = append(pat.Addresses, a)
+								}
+								pat.setFlatFields()
+								pat.Gender = hl7v3Gender(person.AdministrativeGenderCode.Code, person.AdministrativeGenderCode.NullFlavor)
+								pat.BirthDate = hl7v3Date(person.BirthTime.Value)
+								for _, tel := range person.Telecom {
+									pat.Telecom = append(pat.Telecom, newHL7V3Telecom(tel.Value, tel.Use))
 								}
+								pat.Deceased, _ = strconv.ParseBool(person.DeceasedInd.Value)
+								pat.MultipleBirth, _ = strconv.ParseBool(person.MultipleBirthInd.Value)
+								pat.MaritalStatus = person.MaritalStatusCode.Code
+								pat.BirthPlace = person.BirthPlace.Addr.City
+								pat.LastUpdated = hl7v3DateTime(rsppat.EffectiveTime.Value)
+								pat.Status = rsppat.StatusCode.Code
+								pat.Inactive = pat.Status == HL7V3_STATUS_NULLIFIED || pat.Status == HL7V3_STATUS_OBSOLETE
+								pat.checkStatus()
+								pat.MatchScore, _ = strconv.ParseFloat(rsppat.SubjectOf1.QueryMatchObservation.Value.Value, 64)
+								i.addPatient(pat)
+							}
+							if i.rankPatients() {
+								i.setQueryPatient()
 							}
 						}
 					}
 				}
 			}
 		}
-	case tukcnst.PDQ_SERVER_TYPE_IHE_PIXM:
+	case tukcnst.PDQ_SERVER_TYPE_IHE_PIXM, PDQ_SERVER_TYPE_IHE_PDQM:
 		i.Request = []byte(i.Server_URL)
 		httpReq := tukhttp.HTTPRequest{
-			Server:  tukcnst.PDQ_SERVER_TYPE_IHE_PIXM,
+			Server:  i.Server_Mode,
 			Method:  http.MethodGet,
-			URL:     i.Server_URL + "?identifier=" + i.Used_PID_OID + "|" + i.Used_PID + tukcnst.FORMAT_JSON_PRETTY,
+			URL:     i.fhirSearchURL(),
 			Timeout: i.Timeout,
 		}
-		err = tukhttp.NewRequest(&httpReq)
+		err = i.newHTTPRequest(&httpReq)
 		i.Response = httpReq.Response
 		i.StatusCode = httpReq.StatusCode
 		if err == nil {
-			if strings.Contains(string(i.Response), "Error") {
-				err = errors.New(string(i.Response))
-			} else {
-				if err := json.Unmarshal(i.Response, &i.PIXmResponse); err == nil {
+			if i.OperationOutcome, err = newOutcomeError(i.StatusCode, i.Response); err == nil && i.OperationOutcome == nil {
+				if err = json.Unmarshal(i.Response, &i.PIXmResponse); err == nil {
 					log.Printf("%v Patient Entries in Response", i.PIXmResponse.Total)
 					i.Count = i.PIXmResponse.Total
-					if i.Count > 0 {
+					if i.OperationOutcome, err = i.PIXmResponse.outcome(i.StatusCode); err == nil && i.Count > 0 {
 						for cnt := 0; cnt < len(i.PIXmResponse.Entry); cnt++ {
 							rsppat := i.PIXmResponse.Entry[cnt]
-							for _, id := range rsppat.Resource.Identifier {
-								if id.System == tukcnst.URN_OID_PREFIX+i.REG_OID {
-									i.REG_ID = id.Value
-									log.Printf("Set Reg ID %s %s", i.REG_ID, i.REG_OID)
-								}
-								if id.Use == "usual" {
-									i.MRN_ID = id.Value
-									i.MRN_OID = strings.Split(id.System, ":")[2]
-									log.Printf("Set PID %s %s", i.MRN_ID, i.MRN_OID)
-								}
-								if id.System == tukcnst.URN_OID_PREFIX+i.NHS_OID {
-									i.NHS_ID = id.Value
-									log.Printf("Set NHS ID %s %s", i.NHS_ID, i.NHS_OID)
-								}
+							if rsppat.Resource.ResourceType == FHIR_RESOURCE_OPERATION_OUTCOME {
+								continue
 							}
-							gn := ""
-							for _, name := range rsppat.Resource.Name {
-								for _, n := range name.Given {
-									gn = gn + n + " "
-								}
-							}
-							i.GivenName = strings.TrimSuffix(gn, " ")
-							i.FamilyName = rsppat.Resource.Name[0].Family
-							i.BirthDate = strings.ReplaceAll(rsppat.Resource.BirthDate, "-", "")
-							i.Gender = rsppat.Resource.Gender
-
-							if len(rsppat.Resource.Address) > 0 {
-								i.Zip = rsppat.Resource.Address[0].PostalCode
-								if len(rsppat.Resource.Address[0].Line) > 0 {
-									i.Street = rsppat.Resource.Address[0].Line[0]
-									if len(rsppat.Resource.Address[0].Line) > 1 {
-										i.Town = rsppat.Resource.Address[0].Line[1]
-									}
-								}
-								i.City = rsppat.Resource.Address[0].City
-								i.Country = rsppat.Resource.Address[0].Country
+							pat := i.newPIXmPatient(rsppat.Resource)
+							if i.Follow_Replaced_By && len(pat.ReplacedBy) > 0 {
+								pat = i.followReplacedBy(pat)
 							}
+							i.addPatient(pat)
+						}
+						if i.rankPatients() {
+							i.setQueryPatient()
 						}
 					}
 				}
@@ -1081,16 +1164,102 @@ func (i *PDQQuery) setPatient() error {
 	}
 	return err
 }
+func (i *PDQQuery) newPIXmPatient(rsp PIXmResource) TUKPatient {
+	pat := TUKPatient{}
+	for _, id := range rsp.Identifier {
+		aa, _ := Authority_From_System(id.System)
+		pat.addID(i, PatientID{Value: id.Value, Use: id.Use, Authority: aa})
+		if id.Use == "usual" {
+			pat.PID = id.Value
+			if pat.PIDOID = aa.OID; pat.PIDOID == "" {
+				pat.PIDSystem = id.System
+			}
+		}
+	}
+	pat.Names = rsp.Name
+	pat.Addresses = rsp.Address
+	pat.Telecom = rsp.Telecom
+	pat.setFlatFields()
+	pat.BirthDate = strings.ReplaceAll(rsp.BirthDate, "-", "")
+	pat.Gender = rsp.Gender
+	pat.LastUpdated = rsp.Meta.LastUpdated
+	pat.Reference = FHIR_RESOURCE_PATIENT + "/" + rsp.ID
+	pat.Inactive = rsp.Active != nil && !*rsp.Active
+	for _, link := range rsp.Link {
+		switch link.Type {
+		case FHIR_LINK_REPLACED_BY:
+			pat.ReplacedBy = append(pat.ReplacedBy, link.Other.Reference)
+		case FHIR_LINK_REPLACES:
+			pat.Replaces = append(pat.Replaces, link.Other.Reference)
+		}
+	}
+	pat.checkStatus()
+	return pat
+}
 func (i *PDQQuery) newIHESOAPRequest(soapaction string) error {
 	httpReq := tukhttp.HTTPRequest{
-		Method:     http.MethodPost,
-		URL:        i.Server_URL,
-		SOAPAction: soapaction,
-		Body:       i.Request,
-		Timeout:    i.Timeout,
+		Method:      http.MethodPost,
+		URL:         i.Server_URL,
+		SOAPAction:  soapaction,
+		ContentType: tukcnst.SOAP_XML,
+		Body:        i.Request,
+		Timeout:     i.Timeout,
+		DebugMode:   i.DebugMode,
 	}
-	err := tukhttp.NewRequest(&httpReq)
+	err := i.newHTTPRequest(&httpReq)
 	i.Response = httpReq.Response
 	i.StatusCode = httpReq.StatusCode
 	return err
 }
+func (i *PDQQuery) newHTTPRequest(httpReq *tukhttp.HTTPRequest) error {
+	if i.HTTPClient != nil {
+		return newClientRequest(i.HTTPClient, httpReq)
+	}
+	return tukhttp.NewRequest(httpReq)
+}
+
+// newClientRequest sends the request with the supplied http client, setting the same headers and response fields as tukhttp
+func newClientRequest(client *http.Client, r *tukhttp.HTTPRequest) error {
+	if r.Timeout == 0 {
+		r.Timeout = 15
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.Timeout)*time.Second)
+	defer cancel()
+	var body io.Reader
+	if r.Method == http.MethodPost && len(r.Body) > 0 {
+		body = bytes.NewReader(r.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.Method, r.URL, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(tukcnst.ACCEPT, tukcnst.ALL)
+	req.Header.Set(tukcnst.CONNECTION, tukcnst.KEEP_ALIVE)
+	if r.ContentType != "" {
+		req.Header.Set(tukcnst.CONTENT_TYPE, r.ContentType)
+	}
+	if r.X_Api_Key != "" && r.X_Api_Secret != "" {
+		req.Header.Set("X-API-KEY", r.X_Api_Key)
+		req.Header.Set("X-API-SECRET", r.X_Api_Secret)
+	}
+	if r.SOAPAction != "" {
+		req.Header.Set(tukcnst.SOAP_ACTION, r.SOAPAction)
+	}
+	if r.DebugMode {
+		log.Printf("HTTP Request\n-- URL = %s\n-- Body:\n%s", r.URL, string(r.Body))
+	}
+	rsp, err := client.Do(req)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	defer rsp.Body.Close()
+	if r.Response, err = io.ReadAll(rsp.Body); err != nil {
+		return err
+	}
+	r.StatusCode = rsp.StatusCode
+	if r.DebugMode {
+		log.Printf("HTML Response - Status Code = %v\n-- Response--\n%s", r.StatusCode, string(r.Response))
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package tukpdq
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	NHS_NUMBER_LENGTH          = 10
+	NHS_NUMBER_TEST_RANGE_FROM = "9990000000"
+	NHS_NUMBER_TEST_RANGE_TO   = "9999999999"
+)
+
+var (
+	ukPostcode  = regexp.MustCompile(`^(GIR ?0AA|[A-PR-UWYZ]([0-9]{1,2}|[A-HK-Y][0-9]{1,2}|[0-9][A-HJKPS-UW]|[A-HK-Y][0-9][ABEHMNPRV-Y]) ?[0-9][ABD-HJLNP-UW-Z]{2})$`)
+	dateLayouts = []string{"20060102", "2006-01-02", "200601", "2006-01", "2006"}
+	genderCodes = map[string]bool{"male": true, "female": true, "other": true, "unknown": true, "M": true, "F": true, "UN": true}
+	ukCountries = map[string]bool{"": true, "gb": true, "gbr": true, "uk": true, "united kingdom": true, "england": true, "scotland": true, "wales": true, "northern ireland": true}
+)
+
+// ValidationError is returned when a query value fails validation before the request is sent to the pdq server
+type ValidationError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid request - " + e.detail()
+}
+func (e *ValidationError) detail() string {
+	if e.Value == "" {
+		return e.Field + " " + e.Reason
+	}
+	return e.Field + " " + e.Value + " " + e.Reason
+}
+
+// ConfigurationError is returned when a server setting the query needs, such as the server url or an OID, is not set
+type ConfigurationError struct {
+	Setting string
+	Reason  string
+}
+
+func (e *ConfigurationError) Error() string {
+	return "invalid request - " + e.Setting + " " + e.Reason
+}
+
+// ValidationErrors is returned by Validate with every problem found in the query
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	var details []string
+	for _, v := range e {
+		details = append(details, v.detail())
+	}
+	return "invalid request - " + strings.Join(details, ", ")
+}
+
+// As allows errors.As to match the first ValidationError
+func (e ValidationErrors) As(target interface{}) bool {
+	if t, ok := target.(**ValidationError); ok && len(e) > 0 {
+		*t = e[0]
+		return true
+	}
+	return false
+}
+
+// Validate checks the query OIDs, NHS id, birth date, gender and postcode and returns all the problems found
+func (i *PDQQuery) Validate() error {
+	var errs ValidationErrors
+	for _, oid := range []struct{ field, value string }{{"nhs oid", i.NHS_OID}, {"mrn oid", i.MRN_OID}, {"reg oid", i.REG_OID}, {"delphi local id oid", i.Delphi_Local_ID_OID}} {
+		if oid.value != "" && !isOID(oid.value) {
+			errs = append(errs, &ValidationError{Field: oid.field, Value: oid.value, Reason: "is not a valid oid"})
+		}
+	}
+	if err := i.validateNHSID(); err != nil {
+		errs = append(errs, err)
+	}
+	if i.BirthDate != "" && !isDate(i.BirthDate) {
+		errs = append(errs, &ValidationError{Field: "birth date", Value: i.BirthDate, Reason: "is not a valid date"})
+	}
+	if i.Gender != "" && !genderCodes[i.Gender] && !genderCodes[strings.ToLower(i.Gender)] {
+		errs = append(errs, &ValidationError{Field: "gender", Value: i.Gender, Reason: "is not an administrative gender code"})
+	}
+	if i.Zip != "" && i.Is_Demographic_Search() && ukCountries[strings.ToLower(strings.TrimSpace(i.Country))] && !ukPostcode.MatchString(strings.ToUpper(strings.TrimSpace(i.Zip))) {
+		errs = append(errs, &ValidationError{Field: "zip", Value: i.Zip, Reason: "is not a valid uk postcode"})
+	}
+	if i.Match_Sort_Order != "" && i.Match_Sort_Order != MATCH_SORT_DESCENDING && i.Match_Sort_Order != MATCH_SORT_ASCENDING {
+		errs = append(errs, &ValidationError{Field: "match sort order", Value: i.Match_Sort_Order, Reason: "is not desc or asc"})
+	}
+	switch i.PIXm_System {
+	case "", PIXM_SYSTEM_OID, PIXM_SYSTEM_URN_OID, PIXM_SYSTEM_FHIR:
+	default:
+		errs = append(errs, &ValidationError{Field: "pixm system", Value: i.PIXm_System, Reason: "is not oid, urn:oid or fhir"})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Is_Demographic_Search returns true if the query has no patient id
+func (i *PDQQuery) Is_Demographic_Search() bool {
+	if i.NHS_ID != "" || i.MRN_ID != "" || i.REG_ID != "" || i.Delphi_Local_ID != "" {
+		return false
+	}
+	for _, id := range i.Identifiers {
+		if id.Value != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Normalise_NHS_Number removes any spaces and hyphens from an NHS number
+func Normalise_NHS_Number(nhs string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(nhs))
+}
+
+// Validate_NHS_Number checks the NHS number is 10 digits with a valid Modulus 11 check digit
+func Validate_NHS_Number(nhs string) error {
+	n := Normalise_NHS_Number(nhs)
+	if len(n) != NHS_NUMBER_LENGTH {
+		return &ValidationError{Field: "nhs id", Value: nhs, Reason: "is not 10 digits"}
+	}
+	sum := 0
+	for d, c := range n {
+		if c < '0' || c > '9' {
+			return &ValidationError{Field: "nhs id", Value: nhs, Reason: "contains non numeric characters"}
+		}
+		if d < NHS_NUMBER_LENGTH-1 {
+			sum = sum + int(c-'0')*(NHS_NUMBER_LENGTH-d)
+		}
+	}
+	check := 11 - sum%11
+	if check == 11 {
+		check = 0
+	}
+	if check == 10 || check != int(n[NHS_NUMBER_LENGTH-1]-'0') {
+		return &ValidationError{Field: "nhs id", Value: nhs, Reason: "has an invalid check digit"}
+	}
+	return nil
+}
+
+// Is_Test_NHS_Number returns true if the NHS number is in the 999 000 0000 to 999 999 9999 range reserved for testing
+func Is_Test_NHS_Number(nhs string) bool {
+	n := Normalise_NHS_Number(nhs)
+	return len(n) == NHS_NUMBER_LENGTH && n >= NHS_NUMBER_TEST_RANGE_FROM && n <= NHS_NUMBER_TEST_RANGE_TO
+}
+
+// validateNHSID validates the query NHS id. Test range NHS numbers are rejected if Reject_Test_NHS_Numbers is set
+func (i *PDQQuery) validateNHSID() *ValidationError {
+	if i.NHS_ID == "" {
+		return nil
+	}
+	if err := Validate_NHS_Number(i.NHS_ID); err != nil {
+		return err.(*ValidationError)
+	}
+	if i.Reject_Test_NHS_Numbers && Is_Test_NHS_Number(i.NHS_ID) {
+		return &ValidationError{Field: "nhs id", Value: i.NHS_ID, Reason: "is in the range reserved for testing"}
+	}
+	return nil
+}
+
+func isDate(date string) bool {
+	for _, layout := range dateLayouts {
+		if _, err := time.Parse(layout, date); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNHSID validates an NHS number returned by the pdq server. Invalid NHS numbers are logged and returned as an issue
+func checkNHSID(nhs string) string {
+	if err := Validate_NHS_Number(nhs); err != nil {
+		issue := err.(*ValidationError).detail()
+		log.Printf("Invalid NHS ID in pdq response - %s", issue)
+		return issue
+	}
+	return ""
+}
@@ -0,0 +1,146 @@
+package tukpdq
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateNHSNumber(t *testing.T) {
+	tests := []struct {
+		nhs    string
+		reason string
+	}{
+		{"9434765919", ""},
+		{"943 476 5919", ""},
+		{"943-476-5919", ""},
+		{" 9999999468 ", ""},
+		{"4010232137", ""},
+		{"4000000020", ""},
+		{"4000000021", "has an invalid check digit"},
+		{"9999999467", "has an invalid check digit"},
+		{"1234567890", "has an invalid check digit"},
+		{"1234567891", "has an invalid check digit"},
+		{"4000000080", "has an invalid check digit"},
+		{"99999A9468", "contains non numeric characters"},
+		{"+999999946", "contains non numeric characters"},
+		{"999999946", "is not 10 digits"},
+		{"99999994680", "is not 10 digits"},
+		{"", "is not 10 digits"},
+	}
+	for _, tt := range tests {
+		err := Validate_NHS_Number(tt.nhs)
+		if tt.reason == "" {
+			if err != nil {
+				t.Errorf("Validate_NHS_Number(%q) = %v, want nil", tt.nhs, err)
+			}
+			continue
+		}
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Reason != tt.reason {
+			t.Errorf("Validate_NHS_Number(%q) = %v, want %q", tt.nhs, err, tt.reason)
+		}
+	}
+}
+
+func TestIsTestNHSNumber(t *testing.T) {
+	tests := []struct {
+		nhs  string
+		want bool
+	}{
+		{"9990000000", true},
+		{"999 999 9468", true},
+		{"9999999999", true},
+		{"9989999999", false},
+		{"9434765919", false},
+		{"999999946", false},
+	}
+	for _, tt := range tests {
+		if got := Is_Test_NHS_Number(tt.nhs); got != tt.want {
+			t.Errorf("Is_Test_NHS_Number(%q) = %v, want %v", tt.nhs, got, tt.want)
+		}
+	}
+}
+
+func TestValidateNHSID(t *testing.T) {
+	i := PDQQuery{NHS_ID: "943 476 5919"}
+	if err := i.Validate(); err != nil || i.NHS_ID != "943 476 5919" {
+		t.Errorf("Validate() = %v, NHS_ID = %q, want nil and an unchanged NHS_ID", err, i.NHS_ID)
+	}
+	i = PDQQuery{Server_Mode: "pixm", Server_URL: "https://pix.example.nhs.uk/fhir/Patient", REG_OID: "2.16.840.1.113883.2.1.3.31.2.1.1", NHS_ID: "943-476-5919"}
+	if err := i.setPDQ_ID(); err != nil || i.NHS_ID != "9434765919" || i.Used_PID != "9434765919" {
+		t.Errorf("setPDQ_ID() = %v, NHS_ID = %q, Used_PID = %q, want nil and 9434765919", err, i.NHS_ID, i.Used_PID)
+	}
+	i = PDQQuery{NHS_ID: "999 999 9468", Reject_Test_NHS_Numbers: true}
+	if err := i.Validate(); err == nil {
+		t.Error("Validate() = nil, want test range error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		query PDQQuery
+		want  []string
+	}{
+		{"valid", PDQQuery{NHS_OID: "2.16.840.1.113883.2.1.4.1", REG_OID: "2.16.840.1.113883.2.1.3.31.2.1.1", BirthDate: "19700101", Gender: "female"}, nil},
+		{"nhs oid", PDQQuery{NHS_OID: "nhs"}, []string{"nhs oid"}},
+		{"mrn oid", PDQQuery{MRN_OID: "1..2"}, []string{"mrn oid"}},
+		{"reg oid", PDQQuery{REG_OID: "urn:oid:1.2.3"}, []string{"reg oid"}},
+		{"delphi local id oid", PDQQuery{Delphi_Local_ID_OID: "1.2."}, []string{"delphi local id oid"}},
+		{"full date", PDQQuery{BirthDate: "1970-01-31"}, nil},
+		{"partial dates", PDQQuery{BirthDate: "197001"}, nil},
+		{"year", PDQQuery{BirthDate: "1970"}, nil},
+		{"impossible date", PDQQuery{BirthDate: "19700231"}, []string{"birth date"}},
+		{"uk date", PDQQuery{BirthDate: "31/01/1970"}, []string{"birth date"}},
+		{"fhir gender", PDQQuery{Gender: "Male"}, nil},
+		{"hl7 v3 gender", PDQQuery{Gender: "UN"}, nil},
+		{"unknown gender", PDQQuery{Gender: "X"}, []string{"gender"}},
+		{"several problems", PDQQuery{REG_OID: "reg", NHS_ID: "1234567890", BirthDate: "1970-13-01", Gender: "boy", Match_Sort_Order: "up"},
+			[]string{"reg oid", "nhs id", "birth date", "gender", "match sort order"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.query.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			var errs ValidationErrors
+			if !errors.As(err, &errs) || len(errs) != len(tt.want) {
+				t.Fatalf("Validate() = %v, want %d validation errors", err, len(tt.want))
+			}
+			for n, field := range tt.want {
+				if errs[n].Field != field {
+					t.Errorf("Validate() error %d field = %q, want %q", n, errs[n].Field, field)
+				}
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) || verr != errs[0] {
+				t.Errorf("errors.As(*ValidationError) = %v, want the first validation error", verr)
+			}
+		})
+	}
+}
+
+func TestValidatePostcode(t *testing.T) {
+	tests := []struct {
+		name  string
+		query PDQQuery
+		valid bool
+	}{
+		{"uk postcode", PDQQuery{FamilyName: "Bloggs", Zip: "LS1 4AP"}, true},
+		{"uk postcode no space", PDQQuery{FamilyName: "Bloggs", Zip: "ls14ap"}, true},
+		{"invalid uk postcode", PDQQuery{FamilyName: "Bloggs", Zip: "90210"}, false},
+		{"invalid postcode gb country", PDQQuery{FamilyName: "Bloggs", Zip: "90210", Country: "GB"}, false},
+		{"non uk country", PDQQuery{FamilyName: "Bloggs", Zip: "90210", Country: "USA"}, true},
+		{"id lookup", PDQQuery{NHS_ID: "9434765919", Zip: "90210"}, true},
+		{"identifier lookup", PDQQuery{Identifiers: []PatientID{New_PatientID("1.2.3", "M1")}, Zip: "D02 X285"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.query.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}